@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gochip8/internal/asm"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runAsm implements the asm subcommand:
+// gochip8 asm [-o rom.ch8] [-sym rom.sym] prog.c8s|prog.8o
+func runAsm(args []string) {
+	fs := flag.NewFlagSet("asm", flag.ExitOnError)
+	out := fs.String("o", "", "Output ROM, defaults to the source name with a .ch8 extension")
+	sym := fs.String("sym", "", "Symbol map output, defaults to the ROM name with a .sym extension, - disables")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: gochip8 asm [-o rom.ch8] [-sym rom.sym] prog.c8s|prog.8o")
+		os.Exit(2)
+	}
+	src := fs.Arg(0)
+	if *out == "" {
+		*out = strings.TrimSuffix(src, filepath.Ext(src)) + ".ch8"
+	}
+	if *sym == "" {
+		*sym = strings.TrimSuffix(*out, filepath.Ext(*out)) + ".sym"
+	}
+	prog, err := asm.AssembleFile(src)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*out, prog.ROM, 0644); err != nil {
+		panic(err)
+	}
+	if *sym == "-" {
+		return
+	}
+	f, err := os.Create(*sym)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	if err := prog.WriteSymbols(f); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gochip8/internal/disasm"
+	"os"
+)
+
+// runDisasm implements the disasm subcommand:
+// gochip8 disasm [-syntax cowgod|octo] [-addr] rom.ch8
+func runDisasm(args []string) {
+	fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+	syntaxName := fs.String("syntax", "cowgod", "Output syntax, cowgod or octo")
+	addresses := fs.Bool("addr", false, "Annotate each line with its address and raw bytes")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: gochip8 disasm [-syntax cowgod|octo] [-addr] rom.ch8")
+		os.Exit(2)
+	}
+	syntax, err := disasm.ParseSyntax(*syntaxName)
+	if err != nil {
+		panic(err)
+	}
+	rom, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(disasm.Disassemble(rom, disasm.Options{Syntax: syntax, Addresses: *addresses}))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gochip8/internal/audio"
+	"gochip8/internal/capture"
+	"gochip8/internal/chip8"
+	"gochip8/internal/headless"
+	"gochip8/internal/machine"
+	"gochip8/internal/movie"
+	"gochip8/internal/palette"
+	"gochip8/roms"
+	"io"
+	"os"
+	"strings"
+)
+
+// stdout wraps os.Stdout so closing an output doesn't close stdout
+type stdout struct{ io.Writer }
+
+func (stdout) Close() error { return nil }
+
+// openOutput returns a writer for path, where "-" is stdout
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return stdout{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+func main() {
+	romLocation := flag.String("rom", "", "Location of the ROM file")
+	testRom := flag.Bool("test", false, "Use the test ROM")
+	quirksProfile := flag.String("quirks", "vip", "Quirks profile, one of "+strings.Join(chip8.QuirksProfileNames(), ", "))
+	ipf := flag.Int("ipf", chip8.DefaultIPF, "Instructions executed per 60 Hz frame")
+	frames := flag.Int("frames", 600, "Number of frames to run")
+	cycles := flag.Int("cycles", 0, "Number of instructions to run, overrides -frames")
+	input := flag.String("input", "", "Key script, e.g. \"30:+5 45:-5\"")
+	inputFile := flag.String("input-file", "", "File containing a key script")
+	format := flag.String("format", "ascii", "Framebuffer output format, ascii or png")
+	scale := flag.Int("scale", 1, "Pixel scale for png output")
+	screenPath := flag.String("screen", "-", "Framebuffer output file, - for stdout")
+	regsPath := flag.String("regs", "", "Register state JSON output file, - for stdout")
+	wavPath := flag.String("wav", "", "Record the buzzer to this WAV file")
+	moviePath := flag.String("movie", "", "Replay a movie file, overriding -quirks, -ipf, -frames, -seed, -rng, -strict and the input flags")
+	tone := flag.Float64("tone", audio.DefaultFrequency, "Buzzer frequency in Hz")
+	volume := flag.Float64("volume", audio.DefaultVolume, "Buzzer volume from 0 to 1, values outside are clamped")
+	waveform := flag.String("waveform", "square", "Buzzer waveform, one of "+strings.Join(audio.WaveformNames(), ", "))
+	seed := flag.Int64("seed", 0, "Random number generator seed")
+	strict := flag.Bool("strict", false, "Stop at the first fault, such as an invalid opcode or stack overflow, and exit with status 1")
+	capturePath := flag.String("capture", "", fmt.Sprintf("Record the screen to this animated .gif or .png (APNG) file, at most the first %d minutes", capture.MaxTicks/chip8.TimerFrequency/60))
+	captureScale := flag.Int("capture-scale", 4, "Pixel scale of the -capture recording")
+	paletteSpec := flag.String("palette", palette.DefaultTheme, "Colours of the png output and -capture, a theme ("+strings.Join(palette.Names(), ", ")+"), 2 or 4 comma separated hex colours or a JSON palette file")
+	rngName := flag.String("rng", chip8.DefaultRNG, "Random number generator, one of "+strings.Join(chip8.RNGNames(), ", "))
+
+	flag.Parse()
+	var rom []byte
+	if *romLocation == "" {
+		if !*testRom {
+			panic("No ROM file specified, use -rom or -test")
+		}
+		rom = roms.TestRomRaw
+	} else {
+		f, err := os.ReadFile(*romLocation)
+		if err != nil {
+			panic(err)
+		}
+		rom = f
+	}
+	quirks, err := chip8.QuirksProfile(*quirksProfile)
+	if err != nil {
+		panic(err)
+	}
+	script := *input
+	if *inputFile != "" {
+		f, err := os.ReadFile(*inputFile)
+		if err != nil {
+			panic(err)
+		}
+		script += "\n" + string(f)
+	}
+	events, err := headless.ParseInput(script)
+	if err != nil {
+		panic(err)
+	}
+	pal, err := palette.Resolve(*paletteSpec)
+	if err != nil {
+		panic(err)
+	}
+	if *moviePath != "" {
+		m, err := movie.Load(*moviePath)
+		if err != nil {
+			panic(err)
+		}
+		if !m.MatchesROM(rom) {
+			panic(movie.ErrROMMismatch)
+		}
+		quirks, *ipf, *frames, *cycles, *seed, *strict = m.Quirks, m.IPF, int(m.Frames), 0, m.Seed, m.Strict
+		if *rngName = m.RNG; m.RNG == "" {
+			*rngName = chip8.DefaultRNG
+		}
+		events = events[:0]
+		for _, ev := range m.Events {
+			events = append(events, headless.KeyEvent{Frame: int(ev.Frame), Key: ev.Key, Down: ev.Down})
+		}
+	}
+
+	var beeper *audio.Beeper
+	if *wavPath != "" {
+		wave, err := audio.ParseWaveform(*waveform)
+		if err != nil {
+			panic(err)
+		}
+		f, err := os.Create(*wavPath)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		sink, err := audio.NewWAVSink(f)
+		if err != nil {
+			panic(err)
+		}
+		beeper = audio.NewBeeper(sink, audio.Config{Frequency: *tone, Volume: *volume, Waveform: wave})
+	}
+
+	var recording *capture.Recorder
+	var display machine.Display
+	if *capturePath != "" {
+		if recording, err = capture.Create(*capturePath, capture.Options{Scale: *captureScale, Palette: pal.Colors()}); err != nil {
+			panic(err)
+		}
+		display = recording
+	}
+
+	policy := chip8.Lenient
+	if *strict {
+		policy = chip8.Strict
+	}
+	c8, fault := headless.Run(rom, headless.Config{
+		Quirks:      quirks,
+		IPF:         *ipf,
+		Frames:      *frames,
+		Cycles:      *cycles,
+		Input:       events,
+		Seed:        *seed,
+		RNG:         *rngName,
+		Audio:       beeper,
+		Display:     display,
+		ErrorPolicy: policy,
+	})
+	if c8 == nil {
+		panic(fault)
+	}
+	if beeper != nil {
+		if err := beeper.Close(); err != nil {
+			panic(err)
+		}
+	}
+	if recording != nil {
+		if recording.Full() {
+			fmt.Fprintf(os.Stderr, "recording stopped at its %d minute limit\n", capture.MaxTicks/chip8.TimerFrequency/60)
+		}
+		if err := recording.Close(); err != nil {
+			panic(err)
+		}
+	}
+
+	screen, err := openOutput(*screenPath)
+	if err != nil {
+		panic(err)
+	}
+	switch *format {
+	case "ascii":
+		_, err = io.WriteString(screen, headless.ASCII(c8))
+	case "png":
+		err = c8.WriteScreenshot(screen, *scale, pal.Colors())
+	default:
+		panic("Unknown format " + *format + ", use ascii or png")
+	}
+	if err != nil {
+		panic(err)
+	}
+	if err := screen.Close(); err != nil {
+		panic(err)
+	}
+	if *regsPath != "" {
+		regs, err := openOutput(*regsPath)
+		if err != nil {
+			panic(err)
+		}
+		if err := headless.WriteRegisters(regs, c8); err != nil {
+			panic(err)
+		}
+		if err := regs.Close(); err != nil {
+			panic(err)
+		}
+	}
+	//the outputs still show the machine as it faulted
+	if fault != nil {
+		fmt.Fprintln(os.Stderr, fault)
+		os.Exit(1)
+	}
+}
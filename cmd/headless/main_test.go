@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"gochip8/internal/chip8"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMainEnv makes the test binary run main instead of the tests, so the
+// command's output and exit status can be checked from a child process
+const runMainEnv = "GOCHIP8_HEADLESS_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// run runs the command with args and returns its stdout, stderr and exit
+// status
+func run(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+// writeROM writes rom to a temporary file and returns its path
+func writeROM(t *testing.T, rom []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rom.ch8")
+	if err := os.WriteFile(path, rom, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScreenOutput(t *testing.T) {
+	stdout, stderr, code := run(t, "-test", "-frames", "5")
+	if code != 0 {
+		t.Fatalf("exit status %d, stderr %q", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+	if len(lines) != 32 || len(lines[0]) != 64 || !strings.Contains(stdout, "#") {
+		t.Errorf("stdout isn't a drawn 64x32 ASCII screen:\n%s", stdout)
+	}
+
+	path := filepath.Join(t.TempDir(), "screen.png")
+	if _, stderr, code := run(t, "-test", "-frames", "5", "-format", "png", "-scale", "3", "-screen", path); code != 0 {
+		t.Fatalf("png output exit status %d, stderr %q", code, stderr)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 192 || b.Dy() != 96 {
+		t.Errorf("png is %dx%d, want 192x96", b.Dx(), b.Dy())
+	}
+}
+
+func TestStrictFault(t *testing.T) {
+	rom := writeROM(t, []byte{
+		0x60, 0x2A, // V0 = 0x2A
+		0xE0, 0x00, // invalid
+	})
+
+	stdout, stderr, code := run(t, "-rom", rom, "-strict", "-screen", os.DevNull, "-regs", "-")
+	if code != 1 || !strings.Contains(stderr, "invalid opcode E000 at 0x202") {
+		t.Fatalf("exit status %d, stderr %q, want 1 and the fault", code, stderr)
+	}
+	var regs chip8.RegisterState
+	if err := json.Unmarshal([]byte(stdout), &regs); err != nil {
+		t.Fatalf("registers %q: %v", stdout, err)
+	}
+	if regs.V[0] != 0x2A || regs.PC != 0x202 {
+		t.Errorf("registers show V0 %02X at PC %03X, want the state at the fault", regs.V[0], regs.PC)
+	}
+
+	if _, stderr, code := run(t, "-rom", rom, "-frames", "2"); code != 0 {
+		t.Errorf("lenient run exit status %d, stderr %q", code, stderr)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no rom", nil, "No ROM file specified"},
+		{"missing rom", []string{"-rom", filepath.Join(t.TempDir(), "missing.ch8")}, "no such file"},
+		{"oversize rom", []string{"-rom", writeROM(t, make([]byte, chip8.MemoryBufferSize))}, "does not fit in memory"},
+		{"unknown format", []string{"-test", "-frames", "1", "-format", "bmp"}, "Unknown format bmp"},
+		{"bad input", []string{"-test", "-input", "5:x"}, "malformed key event"},
+		{"unknown quirks", []string{"-test", "-quirks", "nes"}, "nes"},
+		{"unknown rng", []string{"-test", "-rng", "dice"}, "dice"},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, stderr, code := run(t, tc.args...)
+			//panics exit with status 2
+			if code != 2 || !strings.Contains(stderr, tc.want) {
+				t.Errorf("exit status %d, stderr %q, want 2 and %q", code, stderr, tc.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,26 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"gochip8/internal/asm"
+	"gochip8/internal/audio"
+	"gochip8/internal/capture"
 	"gochip8/internal/chip8"
 	"gochip8/internal/clog"
+	"gochip8/internal/debugger"
+	"gochip8/internal/disasm"
+	"gochip8/internal/keymap"
+	"gochip8/internal/machine"
+	"gochip8/internal/movie"
+	"gochip8/internal/palette"
+	"gochip8/internal/term"
 	"gochip8/internal/ui"
 	"gochip8/roms"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/veandco/go-sdl2/sdl"
 )
@@ -19,62 +33,409 @@ func getRomBytes(romLocation string) []byte {
 	return f
 }
 
+// stateSlotPath returns the file backing a numbered save state slot,
+// stored next to the ROM
+func stateSlotPath(romLocation string, slot int) string {
+	if romLocation == "" {
+		romLocation = "test.ch8"
+	}
+	return fmt.Sprintf("%s.%d.state", strings.TrimSuffix(romLocation, filepath.Ext(romLocation)), slot)
+}
+
+// loadStateFile restores the chip8 from a save state file
+func loadStateFile(c8 *chip8.Chip8, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c8.LoadState(f)
+}
+
+// saveStateFile writes the chip8 state to a save state file
+func saveStateFile(c8 *chip8.Chip8, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := c8.SaveState(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// errQuit stops the machine when the debugger's quit command is issued
+var errQuit = errors.New("quit")
+
+// frontend is the host the machine is shown on and takes its keypad input
+// from, the SDL window or a terminal
+type frontend interface {
+	machine.Display
+	machine.Keypad
+	SetKeymap(km keymap.Keymap) error
+	SetPalette(p palette.Palette)
+	Rewinding() bool
+	SetFault(fault error)
+	SetWaitingForKey(waiting bool)
+}
+
+// captureDisplay shows the frames on the frontend and records them while
+// a capture is running
+type captureDisplay struct {
+	machine.Display
+	recording *capture.Recorder
+}
+
+func (d *captureDisplay) Present(buf []uint32, width, height int) {
+	d.Display.Present(buf, width, height)
+	if d.recording != nil {
+		d.recording.Present(buf, width, height)
+	}
+}
+
+// stop finishes the running capture, if any, and returns the file it was
+// saved to
+func (d *captureDisplay) stop() (string, error) {
+	if d.recording == nil {
+		return "", nil
+	}
+	name := d.recording.Name()
+	err := d.recording.Close()
+	d.recording = nil
+	return name, err
+}
+
+// ignoreKeys is a keypad that drops live input while a movie replays
+type ignoreKeys struct{}
+
+func (ignoreKeys) KeyDown(key uint8) {}
+func (ignoreKeys) KeyUp(key uint8)   {}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "disasm":
+			runDisasm(os.Args[2:])
+			return
+		case "asm":
+			runAsm(os.Args[2:])
+			return
+		}
+	}
 
-	romLocation := flag.String("rom", "", "Location of the ROM file")
+	romLocation := flag.String("rom", "", "Location of the ROM file, .8o Octo sources are compiled on load")
 	testRom := flag.Bool("test", false, "Use the test ROM")
 	debug := flag.Bool("debug", false, "Debug mode")
+	ipf := flag.Int("ipf", chip8.DefaultIPF, "Instructions executed per 60 Hz frame")
+	rewindSeconds := flag.Int("rewind", 10, "Seconds of gameplay kept for rewinding with backspace, 0 disables")
+	statePath := flag.String("state", "", "Save state file to boot from")
+	quirksProfile := flag.String("quirks", "vip", "Quirks profile, one of "+strings.Join(chip8.QuirksProfileNames(), ", "))
+	tone := flag.Float64("tone", audio.DefaultFrequency, "Buzzer frequency in Hz")
+	volume := flag.Float64("volume", audio.DefaultVolume, "Buzzer volume from 0 to 1, 0 disables sound and values outside are clamped")
+	waveform := flag.String("waveform", "square", "Buzzer waveform, one of "+strings.Join(audio.WaveformNames(), ", "))
+	keymapSpec := flag.String("keymap", keymap.DefaultLayout, "Keyboard layout, one of "+strings.Join(keymap.BuiltinNames(), ", ")+", or a JSON keymap file")
+	recordPath := flag.String("record", "", "Record the keypad input to this movie file")
+	replayPath := flag.String("replay", "", "Replay a movie file, its quirks, ipf, seed, RNG and error policy override the flags")
+	seed := flag.Int64("seed", 0, "Random number generator seed, 0 seeds from the clock")
+	strict := flag.Bool("strict", false, "Stop the program at the first fault, such as an invalid opcode or stack overflow")
+	rngName := flag.String("rng", chip8.DefaultRNG, "Random number generator, one of "+strings.Join(chip8.RNGNames(), ", "))
+	frontendName := flag.String("frontend", "sdl", "Where the emulator runs, sdl for a window or term for the terminal")
+	screenshotDir := flag.String("screenshot-dir", ".", "Directory F12 saves numbered PNG screenshots to")
+	screenshotScale := flag.Int("screenshot-scale", 10, "Pixel scale of the screenshots")
+	capturePath := flag.String("capture", "", fmt.Sprintf("Record the screen to this animated .gif or .png (APNG) file, F11 starts and stops numbered recordings in -screenshot-dir. Recordings stop after %d minutes", capture.MaxTicks/chip8.TimerFrequency/60))
+	captureScale := flag.Int("capture-scale", 4, "Pixel scale of the screen recordings")
+	paletteSpec := flag.String("palette", palette.DefaultTheme, "Display colours, a theme ("+strings.Join(palette.Names(), ", ")+"), 2 or 4 comma separated hex colours or a JSON palette file")
+	termMode := flag.String("term-mode", "halfblock", "Characters the terminal frontend draws with, halfblock or braille")
 
 	flag.Parse()
 	var rom []byte
+	var breakpoints map[uint16]string
 
-	if *romLocation == "" {
+	switch {
+	case *romLocation == "":
 		if !*testRom {
 			panic("No ROM file specified, use -rom or -test")
 		}
 		rom = roms.TestRomRaw
-	} else {
+	case asm.IsOcto(*romLocation):
+		prog, err := asm.AssembleFile(*romLocation)
+		if err != nil {
+			panic(err)
+		}
+		rom, breakpoints = prog.ROM, prog.Breakpoints
+	default:
 		rom = getRomBytes(*romLocation)
 	}
 	if len(rom) == 0 {
 		panic("Failed to load ROM")
 	}
+	quirks, err := chip8.QuirksProfile(*quirksProfile)
+	if err != nil {
+		panic(err)
+	}
+	//movies replay from power on, anything that moves the machine
+	//outside of its input would desynchronise them
+	moviePath := *recordPath + *replayPath
+	if moviePath != "" && (*recordPath != "" && *replayPath != "" || *statePath != "" || *debug) {
+		panic("-record and -replay can't be combined with each other, -state or -debug")
+	}
+	var replay *movie.Movie
+	if *replayPath != "" {
+		if replay, err = movie.Load(*replayPath); err != nil {
+			panic(err)
+		}
+		quirks, *ipf = replay.Quirks, replay.IPF
+	}
+	if moviePath != "" {
+		*rewindSeconds = 0
+	}
+	if *frontendName != "sdl" && *frontendName != "term" {
+		panic(fmt.Sprintf("Unknown frontend %q, want sdl or term", *frontendName))
+	}
+	//the debugger reads its commands from the terminal
+	if *frontendName == "term" && *debug {
+		panic("-debug can't be used with -frontend term")
+	}
 	block := make(chan bool)
-	c8 := chip8.Init()
-	c8.Load(rom)
-	ui, err := ui.Init()
+	c8 := chip8.Init(quirks)
+	if err := c8.Load(rom); err != nil {
+		panic(err)
+	}
+	if err := c8.SelectRNG(*rngName); err != nil {
+		panic(err)
+	}
+	if *seed != 0 {
+		c8.SetSeed(*seed)
+	}
+	if *strict {
+		c8.SetErrorPolicy(chip8.Strict)
+	}
+	if *statePath != "" {
+		if err := loadStateFile(c8, *statePath); err != nil {
+			panic(err)
+		}
+	}
+	var keys machine.Keys = c8
+	var recorder *movie.Recorder
+	var player *movie.Player
+	switch {
+	case *recordPath != "":
+		recorder = movie.NewRecorder(c8, *quirksProfile, quirks, *ipf)
+		keys = recorder
+	case replay != nil:
+		if player, err = movie.NewPlayer(c8, replay); err != nil {
+			panic(err)
+		}
+		keys = ignoreKeys{}
+	}
+	km, err := keymap.Resolve(*keymapSpec, c8.ROMHash())
 	if err != nil {
 		panic(err)
 	}
-	if ui == nil {
-		panic("ui is nil")
+	pal, err := palette.Resolve(*paletteSpec)
+	if err != nil {
+		panic(err)
 	}
 	logger := clog.NewLog(0, "MAIN", "c8-emulator")
+	rewind := chip8.NewRewind(*rewindSeconds * chip8.TimerFrequency)
+	//fault is the error a strict chip8 stopped on, rewinding or loading a
+	//state resumes it
+	var fault error
+	wave, err := audio.ParseWaveform(*waveform)
+	if err != nil {
+		panic(err)
+	}
+	var screen frontend
+	var window *ui.UI
+	var sink machine.AudioSink
+	display := &captureDisplay{}
+	switch *frontendName {
+	case "term":
+		mode, err := term.ParseMode(*termMode)
+		if err != nil {
+			panic(err)
+		}
+		//anything printed would scroll the screen away
+		logger = clog.NewLogWithWriters(0, "MAIN", nil)
+		c8.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+		t, err := term.Open(term.Config{Mode: mode})
+		if err != nil {
+			panic(err)
+		}
+		defer t.Close()
+		screen = t
+	default:
+		if window, err = ui.Init(); err != nil {
+			panic(err)
+		}
+		if window == nil {
+			panic("ui is nil")
+		}
+		window.SetStateSlotHandler(func(slot int, load bool) {
+			path := stateSlotPath(*romLocation, slot)
+			if load {
+				if moviePath != "" {
+					logger.Info().Msg("Save states can't be loaded while recording or replaying a movie")
+					return
+				}
+				if err := loadStateFile(c8, path); err != nil {
+					logger.Info().Msg(fmt.Sprintf("Failed to load state slot %d: %v", slot, err))
+					return
+				}
+				rewind.Reset()
+				fault = nil
+				logger.Info().Msg(fmt.Sprintf("Loaded state slot %d from %s", slot, path))
+				return
+			}
+			if err := saveStateFile(c8, path); err != nil {
+				logger.Info().Msg(fmt.Sprintf("Failed to save state slot %d: %v", slot, err))
+				return
+			}
+			logger.Info().Msg(fmt.Sprintf("Saved state slot %d to %s", slot, path))
+		})
+		window.SetScreenshotHandler(func() {
+			path, err := c8.SaveScreenshot(*screenshotDir, *screenshotScale, pal.Colors())
+			if err != nil {
+				logger.Info().Msg(fmt.Sprintf("Failed to save screenshot: %v", err))
+				return
+			}
+			logger.Info().Msg(fmt.Sprintf("Saved screenshot to %s", path))
+		})
+		window.SetCaptureHandler(func() {
+			if display.recording != nil {
+				path, err := display.stop()
+				if err != nil {
+					logger.Info().Msg(fmt.Sprintf("Failed to save recording: %v", err))
+					return
+				}
+				logger.Info().Msg(fmt.Sprintf("Saved recording to %s", path))
+				return
+			}
+			recording, err := capture.CreateNext(*screenshotDir, capture.GIF, capture.Options{Scale: *captureScale, Palette: pal.Colors()})
+			if err != nil {
+				logger.Info().Msg(fmt.Sprintf("Failed to start recording: %v", err))
+				return
+			}
+			display.recording = recording
+			logger.Info().Msg(fmt.Sprintf("Recording to %s", recording.Name()))
+		})
+		defer sdl.Quit()
+		defer window.GetRenderer().Destroy()
+		defer window.GetWindow().Destroy()
+		if *volume > 0 {
+			if sdlAudio, err := window.OpenAudio(); err != nil {
+				logger.Info().Msg(fmt.Sprintf("Sound disabled: %v", err))
+			} else {
+				sink = sdlAudio
+			}
+		}
+		screen = window
+	}
+	screen.SetPalette(pal)
+	display.Display = screen
+	if *capturePath != "" {
+		if display.recording, err = capture.Create(*capturePath, capture.Options{Scale: *captureScale, Palette: pal.Colors()}); err != nil {
+			panic(err)
+		}
+	}
+	if err := screen.SetKeymap(km); err != nil {
+		panic(err)
+	}
 	logger.Info().Msg("Starting...")
-	defer sdl.Quit()
-	defer ui.GetRenderer().Destroy()
-	defer ui.GetWindow().Destroy()
 
+	var dbg *debugger.Debugger
 	if *debug {
-		roms.DumpRomInfo(rom)
+		fmt.Print(disasm.Disassemble(rom, disasm.Options{Addresses: true}))
+		c8.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+		dbg = debugger.New(c8, os.Stdout)
+		for addr, name := range breakpoints {
+			dbg.AddBreakpoint(addr, name)
+		}
+		go dbg.ReadCommands(os.Stdin)
 		go func() {
 			for range block {
-				c8.Cycle()
-				ui.Update(c8.GetDisplayBuffer())
+				dbg.Send("step")
 			}
 		}()
 	}
 
-	for {
-		if running := ui.ProcessInput(c8.GetKeys(), block); !running {
-			break
+	if window != nil {
+		window.SetStepSignal(block)
+	}
+	m := machine.New(c8, machine.Config{
+		IPF:     *ipf,
+		Display: display,
+		Keypad:  screen,
+		Audio:   sink,
+		Sound:   audio.Config{Frequency: *tone, Volume: *volume, Waveform: wave},
+	})
+	defer m.Close()
+	m.SetKeys(keys)
+	//the timers are frozen while paused or rewinding, keep quiet then
+	m.SetMuted(func() bool {
+		return screen.Rewinding() || (dbg != nil && dbg.Paused())
+	})
+	m.SetStep(func() error {
+		//recordings are held in memory until saved and stop at their limit
+		if display.recording != nil && display.recording.Full() {
+			if path, err := display.stop(); err != nil {
+				logger.Info().Msg(fmt.Sprintf("Failed to save recording: %v", err))
+			} else {
+				logger.Info().Msg(fmt.Sprintf("Recording reached its length limit, saved to %s", path))
+			}
+		}
+		defer func() {
+			screen.SetFault(fault)
+			screen.SetWaitingForKey(c8.WaitingForKey())
+		}()
+		switch {
+		case dbg != nil:
+			dbg.RunFrame(*ipf)
+			if dbg.Quit() {
+				return errQuit
+			}
+		case screen.Rewinding():
+			if rewind.StepBack(c8) {
+				fault = nil
+			}
+		case player != nil:
+			if err := player.RunFrame(); err != nil {
+				logger.Info().Msg(err.Error())
+				player = nil
+			} else if player.Done() {
+				logger.Info().Msg("Replay finished")
+				player = nil
+			}
+			if player == nil {
+				m.SetKeys(c8)
+			}
+		default:
+			err := m.Emulate()
+			if err != nil && fault == nil {
+				logger.Info().Msg(fmt.Sprintf("Program stopped: %v", err))
+			}
+			if fault = err; fault != nil {
+				break
+			}
+			rewind.Push(c8)
+			if recorder != nil {
+				recorder.EndFrame()
+			}
 		}
-		if *debug {
-			continue
+		return nil
+	})
+	m.Run(func(err error) bool { return err != errQuit })
+	if path, err := display.stop(); err != nil {
+		logger.Info().Msg(fmt.Sprintf("Failed to save recording: %v", err))
+	} else if path != "" {
+		logger.Info().Msg(fmt.Sprintf("Saved recording to %s", path))
+	}
+	if recorder != nil {
+		if err := recorder.Movie().Save(*recordPath); err != nil {
+			panic(err)
 		}
-		ui.Update(c8.GetDisplayBuffer())
-		c8.Cycle()
-		sdl.Delay(10)
+		logger.Info().Msg(fmt.Sprintf("Saved movie to %s", *recordPath))
 	}
 	logger.Info().Msg("Exiting...")
 }
@@ -0,0 +1,369 @@
+// Package asm assembles classic Cowgod syntax chip8 assembly into ROMs.
+//
+// A line holds an optional label, an instruction or directive, and a
+// comment starting with ';':
+//
+//	loop:   LD V1, 0x2A        ; instructions use Cowgod mnemonics
+//	        DRW V8, VB, 4
+//	        JP loop
+//	WIDTH   equ 64              ; constants
+//	        db 0x3C, 0b01000010 ; bytes
+//	        dw 0x1234           ; big endian words
+//	        sprite "..####..", ".#....#." ; one byte per 8 pixels, # is set
+//	        include "font.c8s"  ; relative to the including file
+//
+// Operands are expressions over numbers, labels, constants and $ (the
+// address of the current line) with the usual C operators and parentheses
+package asm
+
+import (
+	"fmt"
+	"gochip8/internal/chip8"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const maxIncludeDepth = 16
+
+// Error is an assembly error at a source location
+type Error struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// sourceLine is a line of source after includes have been expanded
+type sourceLine struct {
+	file string
+	line int
+	text string
+}
+
+// statement is a parsed line placed at an address
+type statement struct {
+	src      sourceLine
+	addr     uint16
+	mnemonic string
+	operands []string
+}
+
+// Program is the output of the assembler
+type Program struct {
+	ROM []byte
+	// Symbols maps each label to its address
+	Symbols map[string]uint16
+	// Breakpoints maps addresses to the names given by Octo :breakpoint
+	// directives
+	Breakpoints map[uint16]string
+}
+
+// WriteSymbols writes the symbol map as one "address label" line per label,
+// ordered by address
+func (p *Program) WriteSymbols(w io.Writer) error {
+	names := make([]string, 0, len(p.Symbols))
+	for name := range p.Symbols {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ai, aj := p.Symbols[names[i]], p.Symbols[names[j]]
+		if ai != aj {
+			return ai < aj
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "0x%03X %s\n", p.Symbols[name], name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AssembleFile assembles the file at path, .8o files are compiled as Octo
+func AssembleFile(path string) (*Program, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if IsOcto(path) {
+		return CompileOcto(path, src)
+	}
+	return Assemble(path, src)
+}
+
+// IsOcto reports whether path names an Octo source file
+func IsOcto(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".8o")
+}
+
+// Assemble assembles src, which was read from the file name. Includes are
+// resolved relative to the directory of name
+func Assemble(name string, src []byte) (*Program, error) {
+	a := &assembler{
+		labels: map[string]uint16{},
+		consts: map[string]sourceLine{},
+		exprs:  map[string]string{},
+	}
+	lines, err := a.expand(name, string(src), 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.layout(lines); err != nil {
+		return nil, err
+	}
+	rom, err := a.emit()
+	if err != nil {
+		return nil, err
+	}
+	return &Program{ROM: rom, Symbols: a.labels}, nil
+}
+
+// assembler holds the symbol tables shared by both passes
+type assembler struct {
+	statements []statement
+	labels     map[string]uint16
+	// consts holds where each constant was defined and exprs its expression,
+	// constants are evaluated lazily so they may refer to later labels
+	consts    map[string]sourceLine
+	exprs     map[string]string
+	resolving map[string]bool
+}
+
+// expand reads src into lines, recursively splicing in included files
+func (a *assembler) expand(name, src string, depth int) ([]sourceLine, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("%s: includes nested too deeply", name)
+	}
+	var lines []sourceLine
+	for i, text := range strings.Split(src, "\n") {
+		line := sourceLine{file: name, line: i + 1, text: strings.TrimRight(text, "\r")}
+		label, mnemonic, operands, err := splitLine(line.text)
+		if err != nil {
+			return nil, &Error{File: name, Line: line.line, Err: err}
+		}
+		if strings.ToLower(mnemonic) != "include" {
+			lines = append(lines, line)
+			continue
+		}
+		if len(operands) != 1 || !isString(operands[0]) {
+			return nil, &Error{File: name, Line: line.line, Err: fmt.Errorf("include expects a quoted file name")}
+		}
+		path := filepath.Join(filepath.Dir(name), unquote(operands[0]))
+		included, err := os.ReadFile(path)
+		if err != nil {
+			return nil, &Error{File: name, Line: line.line, Err: err}
+		}
+		// keep the include line so a label on it is still defined
+		line.text = ""
+		if label != "" {
+			line.text = label + ":"
+		}
+		lines = append(lines, line)
+		more, err := a.expand(path, string(included), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, more...)
+	}
+	return lines, nil
+}
+
+// layout is the first pass, it assigns addresses to every statement and
+// records labels and constants
+func (a *assembler) layout(lines []sourceLine) error {
+	addr := uint16(chip8.StartAddr)
+	for _, line := range lines {
+		label, mnemonic, operands, err := splitLine(line.text)
+		if err != nil {
+			return &Error{File: line.file, Line: line.line, Err: err}
+		}
+		fail := func(err error) error {
+			return &Error{File: line.file, Line: line.line, Err: err}
+		}
+		if strings.ToLower(mnemonic) == "equ" {
+			if label == "" || len(operands) != 1 {
+				return fail(fmt.Errorf("equ expects NAME equ <expr>"))
+			}
+			if err := a.define(label, line); err != nil {
+				return fail(err)
+			}
+			a.consts[label] = line
+			a.exprs[label] = operands[0]
+			continue
+		}
+		if label != "" {
+			if err := a.define(label, line); err != nil {
+				return fail(err)
+			}
+			a.labels[label] = addr
+		}
+		if mnemonic == "" {
+			continue
+		}
+		size, err := statementSize(mnemonic, operands)
+		if err != nil {
+			return fail(err)
+		}
+		a.statements = append(a.statements, statement{src: line, addr: addr, mnemonic: mnemonic, operands: operands})
+		if int(addr)+size > chip8.MemoryBufferSize {
+			return fail(fmt.Errorf("program does not fit in memory"))
+		}
+		addr += uint16(size)
+	}
+	return nil
+}
+
+// define checks a new symbol name is valid and unused
+func (a *assembler) define(name string, line sourceLine) error {
+	if !isIdentStart(rune(name[0])) {
+		return fmt.Errorf("bad symbol name %q", name)
+	}
+	if _, ok := a.labels[name]; ok {
+		return fmt.Errorf("%s is already defined", name)
+	}
+	if prev, ok := a.consts[name]; ok {
+		return fmt.Errorf("%s is already defined at %s:%d", name, prev.file, prev.line)
+	}
+	if _, reserved := registerOperands[strings.ToUpper(name)]; reserved {
+		return fmt.Errorf("%s is a register name", name)
+	}
+	return nil
+}
+
+// emit is the second pass, it encodes every statement now that all
+// symbols are known
+func (a *assembler) emit() ([]byte, error) {
+	var rom []byte
+	for _, st := range a.statements {
+		lookup := func(name string) (int64, error) {
+			return a.resolve(name, st.addr)
+		}
+		out, err := encodeStatement(st.mnemonic, st.operands, lookup)
+		if err != nil {
+			return nil, &Error{File: st.src.file, Line: st.src.line, Err: err}
+		}
+		rom = append(rom, out...)
+	}
+	return rom, nil
+}
+
+// resolve looks up a symbol, evaluating constants on first use
+func (a *assembler) resolve(name string, here uint16) (int64, error) {
+	if name == "$" {
+		return int64(here), nil
+	}
+	if addr, ok := a.labels[name]; ok {
+		return int64(addr), nil
+	}
+	expr, ok := a.exprs[name]
+	if !ok {
+		return 0, fmt.Errorf("undefined symbol %s", name)
+	}
+	if a.resolving == nil {
+		a.resolving = map[string]bool{}
+	}
+	if a.resolving[name] {
+		return 0, fmt.Errorf("constant %s refers to itself", name)
+	}
+	a.resolving[name] = true
+	defer delete(a.resolving, name)
+	return evalExpr(expr, func(n string) (int64, error) { return a.resolve(n, here) })
+}
+
+// splitLine breaks a line into its label, mnemonic and comma separated
+// operands, dropping the comment
+func splitLine(text string) (label, mnemonic string, operands []string, err error) {
+	text = stripComment(text)
+	if strings.TrimSpace(text) == "" {
+		return "", "", nil, nil
+	}
+	// labels end with a colon, constants are NAME equ expr
+	fields := strings.Fields(text)
+	if strings.HasSuffix(fields[0], ":") && !strings.HasPrefix(fields[0], "\"") {
+		label = strings.TrimSuffix(fields[0], ":")
+		text = strings.TrimSpace(text[strings.Index(text, ":")+1:])
+		if label == "" {
+			return "", "", nil, fmt.Errorf("empty label")
+		}
+	} else if len(fields) > 1 && strings.ToLower(fields[1]) == "equ" {
+		label = fields[0]
+		text = strings.TrimSpace(text[strings.Index(text, fields[0])+len(fields[0]):])
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return label, "", nil, nil
+	}
+	mnemonic, rest, _ := strings.Cut(text, " ")
+	if tab := strings.IndexByte(mnemonic, '\t'); tab >= 0 {
+		mnemonic, rest = text[:tab], text[tab+1:]
+	}
+	operands, err = splitOperands(rest)
+	return label, mnemonic, operands, err
+}
+
+// stripComment removes a ; comment that isn't inside a string
+func stripComment(text string) string {
+	inString := false
+	for i, ch := range text {
+		switch {
+		case ch == '"':
+			inString = !inString
+		case ch == ';' && !inString:
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// splitOperands splits on commas outside strings and parentheses
+func splitOperands(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	var operands []string
+	depth, inString, start := 0, false, 0
+	for i, ch := range s {
+		switch {
+		case ch == '"':
+			inString = !inString
+		case inString:
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == ',' && depth == 0:
+			operands = append(operands, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if inString {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	operands = append(operands, strings.TrimSpace(s[start:]))
+	for _, op := range operands {
+		if op == "" {
+			return nil, fmt.Errorf("empty operand")
+		}
+	}
+	return operands, nil
+}
+
+func isString(s string) bool {
+	return len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"'
+}
+
+func unquote(s string) string {
+	return s[1 : len(s)-1]
+}
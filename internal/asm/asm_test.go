@@ -0,0 +1,189 @@
+package asm_test
+
+import (
+	"bytes"
+	"errors"
+	"gochip8/internal/asm"
+	"gochip8/internal/disasm"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		want []byte
+	}{
+		{
+			name: "forward and backward references",
+			src:  "start: JP end\nend: CALL start",
+			want: []byte{0x12, 0x02, 0x22, 0x00},
+		},
+		{
+			name: "$ is the address of the line",
+			src:  "CLS\nJP $",
+			want: []byte{0x00, 0xE0, 0x12, 0x02},
+		},
+		{
+			name: "constant referring to a later label",
+			src:  "LD I, SPRITE\nSPRITE equ data + 1\ndata: db 0xFF, 0x81",
+			want: []byte{0xA2, 0x03, 0xFF, 0x81},
+		},
+		{
+			name: "constants referring to constants",
+			src:  "TWICE equ ONCE * 2\nONCE equ 0x10\nLD V1, TWICE",
+			want: []byte{0x61, 0x20},
+		},
+		{
+			name: "db, dw and sprite",
+			src:  "db 1, 0b10\ndw 0x1234\nsprite \"#......#\", \"..####..\"",
+			want: []byte{0x01, 0x02, 0x12, 0x34, 0x81, 0x3C},
+		},
+		{
+			name: "comments and blank lines",
+			src:  "; header\n\n  LD V1, 0x2A ; answer",
+			want: []byte{0x61, 0x2A},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			prog, err := asm.Assemble("test.c8s", []byte(tc.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(prog.ROM, tc.want) {
+				t.Errorf("ROM = % X, want % X", prog.ROM, tc.want)
+			}
+		})
+	}
+}
+
+func TestAssembleSymbols(t *testing.T) {
+	prog, err := asm.Assemble("test.c8s", []byte("start: CLS\nloop: JP loop\nSIZE equ 4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := prog.WriteSymbols(buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := "0x200 start\n0x202 loop\n"; buf.String() != want {
+		t.Errorf("symbols = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		line int
+		want string
+	}{
+		{"constant referring to itself", "LD V0, 1\nX equ X + 1\nLD V1, X", 3, "refers to itself"},
+		{"constants referring to each other", "P equ Q\nQ equ P\nLD V1, P", 3, "refers to itself"},
+		{"undefined symbol", "CLS\n\nJP nowhere", 3, "undefined symbol nowhere"},
+		{"label defined twice", "a: CLS\na: CLS", 2, "a is already defined"},
+		{"register as a label", "V1: CLS", 1, "register name"},
+		{"unknown instruction", "CLS\nFOO V1", 2, "FOO"},
+		{"unterminated string", "sprite \"#...", 1, "unterminated string"},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := asm.Assemble("test.c8s", []byte(tc.src))
+			var asmErr *asm.Error
+			if !errors.As(err, &asmErr) {
+				t.Fatalf("Assemble returned %v, want an *asm.Error", err)
+			}
+			if asmErr.File != "test.c8s" || asmErr.Line != tc.line {
+				t.Errorf("error at %s:%d, want test.c8s:%d", asmErr.File, asmErr.Line, tc.line)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error %q doesn't mention %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// writeFiles creates the files, keyed by slash separated path, in a
+// temporary directory and returns it
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestAssembleIncludes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.c8s":      "CALL draw\ninclude \"lib/draw.c8s\"\ndb DIGITS",
+		"lib/draw.c8s":  "draw: LD I, font\ninclude \"font.c8s\"",
+		"lib/font.c8s":  "DIGITS equ 2\nRET\nfont: db 0xF0",
+		"deep/self.c8s": "CLS\ninclude \"self.c8s\"",
+		"bad/main.c8s":  "CLS\ninclude \"bad.c8s\"",
+		"bad/bad.c8s":   "CLS\nLD V1, missing",
+	})
+
+	prog, err := asm.AssembleFile(filepath.Join(dir, "main.c8s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x22, 0x02, 0xA2, 0x06, 0x00, 0xEE, 0xF0, 0x02}
+	if !bytes.Equal(prog.ROM, want) {
+		t.Errorf("ROM = % X, want % X", prog.ROM, want)
+	}
+
+	_, err = asm.AssembleFile(filepath.Join(dir, "deep", "self.c8s"))
+	if err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Errorf("recursive include returned %v, want an error about nesting", err)
+	}
+
+	_, err = asm.AssembleFile(filepath.Join(dir, "bad", "main.c8s"))
+	var asmErr *asm.Error
+	if !errors.As(err, &asmErr) {
+		t.Fatalf("error in an included file returned %v, want an *asm.Error", err)
+	}
+	if wantFile := filepath.Join(dir, "bad", "bad.c8s"); asmErr.File != wantFile || asmErr.Line != 2 {
+		t.Errorf("error at %s:%d, want %s:2", asmErr.File, asmErr.Line, wantFile)
+	}
+}
+
+// TestAssembleRoundTrip reassembles the Cowgod disassembly of the bundled ROMs
+func TestAssembleRoundTrip(t *testing.T) {
+	roms, err := filepath.Glob(filepath.Join("..", "..", "roms", "*.ch8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roms) == 0 {
+		t.Fatal("no bundled ROMs found")
+	}
+	for _, path := range roms {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			rom, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			src := disasm.Disassemble(rom, disasm.Options{Syntax: disasm.Cowgod})
+			prog, err := asm.Assemble(filepath.Base(path), []byte(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(prog.ROM, rom) {
+				t.Errorf("reassembled ROM differs from %s", path)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// exprToken is a lexical token of an expression
+type exprToken struct {
+	kind string // "num", "ident", "op", "(", ")"
+	text string
+	num  int64
+}
+
+// tokenizeExpr splits an expression into tokens
+func tokenizeExpr(s string) ([]exprToken, error) {
+	var toks []exprToken
+	for i := 0; i < len(s); {
+		ch := rune(s[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case unicode.IsDigit(ch):
+			j := i
+			for j < len(s) && (isIdentChar(rune(s[j]))) {
+				j++
+			}
+			n, err := parseInt(s[i:j])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, exprToken{kind: "num", text: s[i:j], num: n})
+			i = j
+		case ch == '$':
+			toks = append(toks, exprToken{kind: "ident", text: "$"})
+			i++
+		case isIdentStart(ch):
+			j := i
+			for j < len(s) && isIdentChar(rune(s[j])) {
+				j++
+			}
+			toks = append(toks, exprToken{kind: "ident", text: s[i:j]})
+			i = j
+		case ch == '(' || ch == ')':
+			toks = append(toks, exprToken{kind: string(ch), text: string(ch)})
+			i++
+		case strings.HasPrefix(s[i:], "<<") || strings.HasPrefix(s[i:], ">>"):
+			toks = append(toks, exprToken{kind: "op", text: s[i : i+2]})
+			i += 2
+		case strings.ContainsRune("+-*/%&|^~", ch):
+			toks = append(toks, exprToken{kind: "op", text: string(ch)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q in expression", ch)
+		}
+	}
+	return toks, nil
+}
+
+func isIdentStart(ch rune) bool {
+	return ch == '_' || ch == '.' || unicode.IsLetter(ch)
+}
+
+func isIdentChar(ch rune) bool {
+	return isIdentStart(ch) || unicode.IsDigit(ch)
+}
+
+// parseInt parses a decimal, 0x hex or 0b binary literal
+func parseInt(s string) (int64, error) {
+	lower := strings.ToLower(s)
+	var n uint64
+	var err error
+	switch {
+	case strings.HasPrefix(lower, "0x"):
+		n, err = strconv.ParseUint(lower[2:], 16, 32)
+	case strings.HasPrefix(lower, "0b"):
+		n, err = strconv.ParseUint(lower[2:], 2, 32)
+	default:
+		n, err = strconv.ParseUint(lower, 10, 32)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("bad number %q", s)
+	}
+	return int64(n), nil
+}
+
+// binaryPrecedence orders the binary operators, loosest first
+var binaryPrecedence = map[string]int{
+	"|":  1,
+	"^":  2,
+	"&":  3,
+	"<<": 4,
+	">>": 4,
+	"+":  5,
+	"-":  5,
+	"*":  6,
+	"/":  6,
+	"%":  6,
+}
+
+// exprParser evaluates an expression by precedence climbing, resolving
+// identifiers through lookup
+type exprParser struct {
+	toks   []exprToken
+	pos    int
+	lookup func(name string) (int64, error)
+}
+
+// evalExpr evaluates an expression string
+func evalExpr(s string, lookup func(string) (int64, error)) (int64, error) {
+	toks, err := tokenizeExpr(s)
+	if err != nil {
+		return 0, err
+	}
+	if len(toks) == 0 {
+		return 0, fmt.Errorf("missing expression")
+	}
+	p := &exprParser{toks: toks, lookup: lookup}
+	v, err := p.binary(1)
+	if err != nil {
+		return 0, err
+	}
+	if p.pos != len(p.toks) {
+		return 0, fmt.Errorf("unexpected %q in expression", p.toks[p.pos].text)
+	}
+	return v, nil
+}
+
+func (p *exprParser) peek() *exprToken {
+	if p.pos >= len(p.toks) {
+		return nil
+	}
+	return &p.toks[p.pos]
+}
+
+func (p *exprParser) binary(minPrec int) (int64, error) {
+	left, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		tok := p.peek()
+		if tok == nil || tok.kind != "op" {
+			return left, nil
+		}
+		prec, ok := binaryPrecedence[tok.text]
+		if !ok || prec < minPrec {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.binary(prec + 1)
+		if err != nil {
+			return 0, err
+		}
+		switch tok.text {
+		case "|":
+			left |= right
+		case "^":
+			left ^= right
+		case "&":
+			left &= right
+		case "<<":
+			left <<= uint(right)
+		case ">>":
+			left >>= uint(right)
+		case "+":
+			left += right
+		case "-":
+			left -= right
+		case "*":
+			left *= right
+		case "/", "%":
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			if tok.text == "/" {
+				left /= right
+			} else {
+				left %= right
+			}
+		}
+	}
+}
+
+func (p *exprParser) unary() (int64, error) {
+	tok := p.peek()
+	if tok == nil {
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch {
+	case tok.kind == "op" && tok.text == "-":
+		v, err := p.unary()
+		return -v, err
+	case tok.kind == "op" && tok.text == "~":
+		v, err := p.unary()
+		return ^v, err
+	case tok.kind == "op" && tok.text == "+":
+		return p.unary()
+	case tok.kind == "num":
+		return tok.num, nil
+	case tok.kind == "ident":
+		return p.lookup(tok.text)
+	case tok.kind == "(":
+		v, err := p.binary(1)
+		if err != nil {
+			return 0, err
+		}
+		if next := p.peek(); next == nil || next.kind != ")" {
+			return 0, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return v, nil
+	}
+	return 0, fmt.Errorf("unexpected %q in expression", tok.text)
+}
@@ -0,0 +1,386 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// registerOperands are the operand names that aren't expressions
+var registerOperands = map[string]bool{
+	"I": true, "[I]": true, "DT": true, "ST": true, "K": true, "F": true,
+	"HF": true, "B": true, "R": true, "PITCH": true,
+	"V0": true, "V1": true, "V2": true, "V3": true, "V4": true, "V5": true, "V6": true, "V7": true,
+	"V8": true, "V9": true, "VA": true, "VB": true, "VC": true, "VD": true, "VE": true, "VF": true,
+}
+
+// statementSize returns the number of bytes a statement assembles to. It
+// only looks at the shape of the operands so it can run before labels are
+// known
+func statementSize(mnemonic string, operands []string) (int, error) {
+	switch strings.ToLower(mnemonic) {
+	case "db":
+		if len(operands) == 0 {
+			return 0, fmt.Errorf("db expects at least one value")
+		}
+		size := 0
+		for _, op := range operands {
+			if isString(op) {
+				size += len(unquote(op))
+				continue
+			}
+			size++
+		}
+		return size, nil
+	case "dw":
+		if len(operands) == 0 {
+			return 0, fmt.Errorf("dw expects at least one value")
+		}
+		return 2 * len(operands), nil
+	case "sprite":
+		if len(operands) == 0 {
+			return 0, fmt.Errorf("sprite expects at least one row")
+		}
+		size := 0
+		for _, op := range operands {
+			if !isString(op) {
+				return 0, fmt.Errorf("sprite rows must be quoted strings")
+			}
+			size += (len(unquote(op)) + 7) / 8
+		}
+		return size, nil
+	case "ldl":
+		return 4, nil
+	}
+	return 2, nil
+}
+
+// operands wraps the operands of one statement with typed accessors
+type operands struct {
+	args   []string
+	lookup func(string) (int64, error)
+}
+
+// reg returns the V register index of operand i, or false if it isn't one
+func (o operands) reg(i int) (uint16, bool) {
+	s := strings.ToUpper(o.args[i])
+	if len(s) != 2 || s[0] != 'V' {
+		return 0, false
+	}
+	n, err := parseInt("0x" + s[1:])
+	if err != nil {
+		return 0, false
+	}
+	return uint16(n), true
+}
+
+// is reports whether operand i is the named special register
+func (o operands) is(i int, name string) bool {
+	return strings.EqualFold(o.args[i], name)
+}
+
+// value evaluates operand i and checks it lies in [min, max]
+func (o operands) value(i int, min, max int64) (uint16, error) {
+	if registerOperands[strings.ToUpper(o.args[i])] {
+		return 0, fmt.Errorf("expected a value, got %s", o.args[i])
+	}
+	v, err := evalExpr(o.args[i], o.lookup)
+	if err != nil {
+		return 0, err
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("%s is out of range [%d, %d]", o.args[i], min, max)
+	}
+	return uint16(v), nil
+}
+
+func (o operands) byte(i int) (uint16, error) {
+	v, err := o.value(i, -128, 0xFF)
+	return v & 0xFF, err
+}
+
+func (o operands) addr(i int) (uint16, error) {
+	return o.value(i, 0, 0xFFF)
+}
+
+func (o operands) nibble(i int) (uint16, error) {
+	return o.value(i, 0, 0xF)
+}
+
+// encodeStatement assembles one instruction or data directive
+func encodeStatement(mnemonic string, args []string, lookup func(string) (int64, error)) ([]byte, error) {
+	o := operands{args: args, lookup: lookup}
+	switch m := strings.ToUpper(mnemonic); m {
+	case "DB":
+		var out []byte
+		for i, arg := range args {
+			if isString(arg) {
+				out = append(out, unquote(arg)...)
+				continue
+			}
+			b, err := o.byte(i)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, uint8(b))
+		}
+		return out, nil
+	case "DW":
+		var out []byte
+		for i := range args {
+			w, err := o.value(i, -0x8000, 0xFFFF)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, uint8(w>>8), uint8(w))
+		}
+		return out, nil
+	case "SPRITE":
+		var out []byte
+		for _, arg := range args {
+			row, err := spriteRow(unquote(arg))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, row...)
+		}
+		return out, nil
+	case "LDL":
+		if len(args) != 2 || !o.is(0, "I") {
+			return nil, fmt.Errorf("usage: LDL I, addr")
+		}
+		addr, err := o.value(1, 0, 0xFFFF)
+		if err != nil {
+			return nil, err
+		}
+		return []byte{0xF0, 0x00, uint8(addr >> 8), uint8(addr)}, nil
+	}
+	op, err := encodeInstruction(strings.ToUpper(mnemonic), o)
+	if err != nil {
+		return nil, err
+	}
+	return []byte{uint8(op >> 8), uint8(op)}, nil
+}
+
+// spriteRow turns a row of pixels such as "..##..##" into bytes, '#' and
+// '1' are set pixels and anything else is clear
+func spriteRow(row string) ([]byte, error) {
+	if len(row) == 0 {
+		return nil, fmt.Errorf("empty sprite row")
+	}
+	out := make([]byte, (len(row)+7)/8)
+	for i, ch := range row {
+		if ch == '#' || ch == '1' {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out, nil
+}
+
+// encodeInstruction assembles a two byte instruction
+func encodeInstruction(m string, o operands) (uint16, error) {
+	n := len(o.args)
+	want := func(count int, usage string) error {
+		if n != count {
+			return fmt.Errorf("usage: %s", usage)
+		}
+		return nil
+	}
+	switch m {
+	case "CLS", "RET", "SCR", "SCL", "EXIT", "LOW", "HIGH", "AUDIO":
+		if err := want(0, m); err != nil {
+			return 0, err
+		}
+		return map[string]uint16{
+			"CLS": 0x00E0, "RET": 0x00EE, "SCR": 0x00FB, "SCL": 0x00FC,
+			"EXIT": 0x00FD, "LOW": 0x00FE, "HIGH": 0x00FF, "AUDIO": 0xF002,
+		}[m], nil
+	case "SCD", "SCU", "PLANE":
+		if err := want(1, m+" n"); err != nil {
+			return 0, err
+		}
+		v, err := o.nibble(0)
+		if err != nil {
+			return 0, err
+		}
+		switch m {
+		case "SCD":
+			return 0x00C0 | v, nil
+		case "SCU":
+			return 0x00D0 | v, nil
+		}
+		return 0xF001 | v<<8, nil
+	case "SYS", "CALL":
+		if err := want(1, m+" addr"); err != nil {
+			return 0, err
+		}
+		addr, err := o.addr(0)
+		if m == "CALL" {
+			addr |= 0x2000
+		}
+		return addr, err
+	case "JP":
+		if n == 2 {
+			if x, ok := o.reg(0); !ok || x != 0 {
+				return 0, fmt.Errorf("usage: JP V0, addr")
+			}
+			addr, err := o.addr(1)
+			return 0xB000 | addr, err
+		}
+		if err := want(1, "JP addr"); err != nil {
+			return 0, err
+		}
+		addr, err := o.addr(0)
+		return 0x1000 | addr, err
+	case "SE", "SNE":
+		if err := want(2, m+" Vx, byte|Vy"); err != nil {
+			return 0, err
+		}
+		x, ok := o.reg(0)
+		if !ok {
+			return 0, fmt.Errorf("%s expects a V register, got %s", m, o.args[0])
+		}
+		if y, ok := o.reg(1); ok {
+			if m == "SE" {
+				return 0x5000 | x<<8 | y<<4, nil
+			}
+			return 0x9000 | x<<8 | y<<4, nil
+		}
+		nn, err := o.byte(1)
+		if m == "SE" {
+			return 0x3000 | x<<8 | nn, err
+		}
+		return 0x4000 | x<<8 | nn, err
+	case "SAVE", "LOAD":
+		if err := want(2, m+" Vx, Vy"); err != nil {
+			return 0, err
+		}
+		x, okx := o.reg(0)
+		y, oky := o.reg(1)
+		if !okx || !oky {
+			return 0, fmt.Errorf("usage: %s Vx, Vy", m)
+		}
+		if m == "SAVE" {
+			return 0x5002 | x<<8 | y<<4, nil
+		}
+		return 0x5003 | x<<8 | y<<4, nil
+	case "LD":
+		if err := want(2, "LD dst, src"); err != nil {
+			return 0, err
+		}
+		return encodeLoad(o)
+	case "ADD":
+		if err := want(2, "ADD dst, src"); err != nil {
+			return 0, err
+		}
+		if o.is(0, "I") {
+			x, ok := o.reg(1)
+			if !ok {
+				return 0, fmt.Errorf("usage: ADD I, Vx")
+			}
+			return 0xF01E | x<<8, nil
+		}
+		x, ok := o.reg(0)
+		if !ok {
+			return 0, fmt.Errorf("ADD expects I or a V register, got %s", o.args[0])
+		}
+		if y, ok := o.reg(1); ok {
+			return 0x8004 | x<<8 | y<<4, nil
+		}
+		nn, err := o.byte(1)
+		return 0x7000 | x<<8 | nn, err
+	case "OR", "AND", "XOR", "SUB", "SUBN", "SHR", "SHL":
+		logic := map[string]uint16{"OR": 1, "AND": 2, "XOR": 3, "SUB": 5, "SHR": 6, "SUBN": 7, "SHL": 0xE}[m]
+		// the shifts may leave out Vy, which then defaults to Vx
+		if (m == "SHR" || m == "SHL") && n == 1 {
+			o.args = append(o.args, o.args[0])
+			n = 2
+		}
+		if err := want(2, m+" Vx, Vy"); err != nil {
+			return 0, err
+		}
+		x, okx := o.reg(0)
+		y, oky := o.reg(1)
+		if !okx || !oky {
+			return 0, fmt.Errorf("usage: %s Vx, Vy", m)
+		}
+		return 0x8000 | x<<8 | y<<4 | logic, nil
+	case "RND":
+		if err := want(2, "RND Vx, byte"); err != nil {
+			return 0, err
+		}
+		x, ok := o.reg(0)
+		if !ok {
+			return 0, fmt.Errorf("usage: RND Vx, byte")
+		}
+		nn, err := o.byte(1)
+		return 0xC000 | x<<8 | nn, err
+	case "DRW":
+		if err := want(3, "DRW Vx, Vy, n"); err != nil {
+			return 0, err
+		}
+		x, okx := o.reg(0)
+		y, oky := o.reg(1)
+		if !okx || !oky {
+			return 0, fmt.Errorf("usage: DRW Vx, Vy, n")
+		}
+		rows, err := o.nibble(2)
+		return 0xD000 | x<<8 | y<<4 | rows, err
+	case "SKP", "SKNP":
+		if err := want(1, m+" Vx"); err != nil {
+			return 0, err
+		}
+		x, ok := o.reg(0)
+		if !ok {
+			return 0, fmt.Errorf("usage: %s Vx", m)
+		}
+		if m == "SKP" {
+			return 0xE09E | x<<8, nil
+		}
+		return 0xE0A1 | x<<8, nil
+	}
+	return 0, fmt.Errorf("unknown instruction %s", m)
+}
+
+// loadForms are the FX__ loads, keyed by destination and source with the
+// V register written as Vx
+var loadForms = map[[2]string]uint16{
+	{"VX", "DT"}:    0xF007,
+	{"VX", "K"}:     0xF00A,
+	{"DT", "VX"}:    0xF015,
+	{"ST", "VX"}:    0xF018,
+	{"F", "VX"}:     0xF029,
+	{"HF", "VX"}:    0xF030,
+	{"B", "VX"}:     0xF033,
+	{"PITCH", "VX"}: 0xF03A,
+	{"[I]", "VX"}:   0xF055,
+	{"VX", "[I]"}:   0xF065,
+	{"R", "VX"}:     0xF075,
+	{"VX", "R"}:     0xF085,
+}
+
+// encodeLoad assembles the many forms of LD
+func encodeLoad(o operands) (uint16, error) {
+	if o.is(0, "I") {
+		addr, err := o.addr(1)
+		return 0xA000 | addr, err
+	}
+	dst, src := strings.ToUpper(o.args[0]), strings.ToUpper(o.args[1])
+	x, dstIsReg := o.reg(0)
+	y, srcIsReg := o.reg(1)
+	switch {
+	case dstIsReg && srcIsReg:
+		return 0x8000 | x<<8 | y<<4, nil
+	case dstIsReg && !registerOperands[src]:
+		nn, err := o.byte(1)
+		return 0x6000 | x<<8 | nn, err
+	case dstIsReg:
+		dst = "VX"
+	case srcIsReg:
+		x, src = y, "VX"
+	}
+	op, ok := loadForms[[2]string{dst, src}]
+	if !ok {
+		return 0, fmt.Errorf("unknown load LD %s, %s", o.args[0], o.args[1])
+	}
+	return op | x<<8, nil
+}
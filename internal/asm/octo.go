@@ -0,0 +1,740 @@
+package asm
+
+import (
+	"fmt"
+	"gochip8/internal/chip8"
+	"math"
+	"strings"
+)
+
+const maxMacroDepth = 64
+
+// octoToken is a whitespace separated word of Octo source
+type octoToken struct {
+	text string
+	line int
+}
+
+// tokenizeOcto splits Octo source into words, dropping # comments
+func tokenizeOcto(src string) []octoToken {
+	var toks []octoToken
+	for i, line := range strings.Split(src, "\n") {
+		if comment := strings.IndexByte(line, '#'); comment >= 0 {
+			line = line[:comment]
+		}
+		for _, word := range strings.Fields(line) {
+			toks = append(toks, octoToken{text: word, line: i + 1})
+		}
+	}
+	return toks
+}
+
+// octoMacro is a :macro definition, its body is substituted token by token
+type octoMacro struct {
+	params []string
+	body   []octoToken
+}
+
+// octoFixup is an address operand naming a label that wasn't yet defined
+type octoFixup struct {
+	at   uint16
+	long bool
+	tok  octoToken
+}
+
+// octoLoop is an open loop ... again block, breaks holds the jumps emitted
+// by while that exit the loop
+type octoLoop struct {
+	start  uint16
+	breaks []uint16
+}
+
+// octoCompiler is a single pass Octo compiler, forward references to labels
+// are patched once the whole program has been read
+type octoCompiler struct {
+	toks   []octoToken
+	pos    int
+	mem    [chip8.MemoryBufferSize]byte
+	here   uint16
+	end    uint16
+	labels map[string]uint16
+	consts map[string]float64
+	// aliases maps :alias names to V register indexes
+	aliases     map[string]uint16
+	macros      map[string]*octoMacro
+	fixups      []octoFixup
+	breakpoints map[uint16]string
+	// blocks holds the address of the jump each open begin or else patches
+	blocks      []uint16
+	loops       []octoLoop
+	macroDepth  int
+	currentLine int
+}
+
+// CompileOcto compiles Octo source read from the file name. Besides plain
+// instructions it supports : labels, :alias, :const, :macro, :calc, :org,
+// :byte, :call, :unpack, if ... then, if ... begin ... else ... end,
+// loop ... while ... again and :breakpoint, which names an address the
+// debugger should stop at.
+//
+// Execution starts at the main label. As in Octo, when main isn't the first
+// thing in the program 0x200 is reserved for a jump to it
+func CompileOcto(name string, src []byte) (*Program, error) {
+	toks := tokenizeOcto(string(src))
+	c := newOctoCompiler(toks, chip8.StartAddr)
+	if err := c.compile(); err != nil {
+		return nil, &Error{File: name, Line: c.currentLine, Err: err}
+	}
+	if main, ok := c.labels["main"]; ok && main != chip8.StartAddr {
+		c = newOctoCompiler(toks, chip8.StartAddr+2)
+		if err := c.compile(); err != nil {
+			return nil, &Error{File: name, Line: c.currentLine, Err: err}
+		}
+		c.patchJump(chip8.StartAddr, c.labels["main"])
+	}
+	rom := make([]byte, c.end-chip8.StartAddr)
+	copy(rom, c.mem[chip8.StartAddr:c.end])
+	return &Program{ROM: rom, Symbols: c.labels, Breakpoints: c.breakpoints}, nil
+}
+
+// newOctoCompiler creates a compiler placing the program at start
+func newOctoCompiler(toks []octoToken, start uint16) *octoCompiler {
+	return &octoCompiler{
+		toks:        toks,
+		here:        start,
+		end:         start,
+		labels:      map[string]uint16{},
+		consts:      map[string]float64{},
+		aliases:     map[string]uint16{},
+		macros:      map[string]*octoMacro{},
+		breakpoints: map[uint16]string{},
+	}
+}
+
+func (c *octoCompiler) compile() error {
+	for c.pos < len(c.toks) {
+		if err := c.statement(); err != nil {
+			return err
+		}
+	}
+	switch {
+	case len(c.blocks) > 0:
+		return fmt.Errorf("missing end")
+	case len(c.loops) > 0:
+		return fmt.Errorf("missing again")
+	}
+	for _, f := range c.fixups {
+		addr, ok := c.labels[f.tok.text]
+		if !ok {
+			c.currentLine = f.tok.line
+			return fmt.Errorf("undefined label %s", f.tok.text)
+		}
+		if f.long {
+			c.mem[f.at], c.mem[f.at+1] = uint8(addr>>8), uint8(addr)
+			continue
+		}
+		if addr > 0xFFF {
+			c.currentLine = f.tok.line
+			return fmt.Errorf("label %s at 0x%X is out of reach, use i := long", f.tok.text, addr)
+		}
+		c.mem[f.at] |= uint8(addr >> 8)
+		c.mem[f.at+1] = uint8(addr)
+	}
+	return nil
+}
+
+// next consumes a token
+func (c *octoCompiler) next() (octoToken, error) {
+	if c.pos >= len(c.toks) {
+		return octoToken{}, fmt.Errorf("unexpected end of file")
+	}
+	tok := c.toks[c.pos]
+	c.pos++
+	c.currentLine = tok.line
+	return tok, nil
+}
+
+// peek returns the text of the next token without consuming it
+func (c *octoCompiler) peek() string {
+	if c.pos >= len(c.toks) {
+		return ""
+	}
+	return c.toks[c.pos].text
+}
+
+// expect consumes a token that must be text
+func (c *octoCompiler) expect(text string) error {
+	tok, err := c.next()
+	if err != nil {
+		return err
+	}
+	if tok.text != text {
+		return fmt.Errorf("expected %s, got %s", text, tok.text)
+	}
+	return nil
+}
+
+// emit writes bytes at the current address
+func (c *octoCompiler) emit(bytes ...uint8) error {
+	for _, b := range bytes {
+		if int(c.here) >= chip8.MemoryBufferSize-1 {
+			return fmt.Errorf("program does not fit in memory")
+		}
+		c.mem[c.here] = b
+		c.here++
+	}
+	if c.here > c.end {
+		c.end = c.here
+	}
+	return nil
+}
+
+func (c *octoCompiler) emitOp(op uint16) error {
+	return c.emit(uint8(op>>8), uint8(op))
+}
+
+// emitAddrOp emits op with a 12 bit address taken from the next token,
+// labels that aren't defined yet are patched at the end
+func (c *octoCompiler) emitAddrOp(op uint16) error {
+	tok, err := c.next()
+	if err != nil {
+		return err
+	}
+	return c.emitAddrOpFor(op, tok)
+}
+
+func (c *octoCompiler) emitAddrOpFor(op uint16, tok octoToken) error {
+	if v, ok, err := c.constant(tok.text); err != nil || ok {
+		if err != nil {
+			return err
+		}
+		if v < 0 || v > 0xFFF {
+			return fmt.Errorf("address %s is out of range", tok.text)
+		}
+		return c.emitOp(op | uint16(v))
+	}
+	if !isOctoName(tok.text) {
+		return fmt.Errorf("expected an address, got %s", tok.text)
+	}
+	c.fixups = append(c.fixups, octoFixup{at: c.here, tok: tok})
+	return c.emitOp(op)
+}
+
+// constant evaluates a number, :const, :calc or already defined label
+func (c *octoCompiler) constant(text string) (int64, bool, error) {
+	if v, ok := c.consts[text]; ok {
+		return int64(math.Floor(v)), true, nil
+	}
+	if addr, ok := c.labels[text]; ok {
+		return int64(addr), true, nil
+	}
+	if len(text) == 0 || !(text[0] == '-' || text[0] >= '0' && text[0] <= '9') {
+		return 0, false, nil
+	}
+	v, err := parseOctoNumber(text)
+	return v, err == nil, err
+}
+
+// parseOctoNumber parses a decimal, 0x hex or 0b binary literal with an
+// optional leading minus
+func parseOctoNumber(text string) (int64, error) {
+	if strings.HasPrefix(text, "-") {
+		v, err := parseInt(text[1:])
+		return -v, err
+	}
+	return parseInt(text)
+}
+
+// value reads a number or constant in [min, max]
+func (c *octoCompiler) value(min, max int64) (uint16, error) {
+	tok, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	v, ok, err := c.constant(tok.text)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("undefined constant %s", tok.text)
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("%s is out of range [%d, %d]", tok.text, min, max)
+	}
+	return uint16(v), nil
+}
+
+func (c *octoCompiler) byteValue() (uint16, error) {
+	v, err := c.value(-128, 0xFF)
+	return v & 0xFF, err
+}
+
+// register returns the V register index named by text, including aliases
+func (c *octoCompiler) register(text string) (uint16, bool) {
+	if v, ok := c.aliases[text]; ok {
+		return v, true
+	}
+	lower := strings.ToLower(text)
+	if len(lower) != 2 || lower[0] != 'v' {
+		return 0, false
+	}
+	v, err := parseInt("0x" + lower[1:])
+	return uint16(v), err == nil
+}
+
+// nextRegister consumes a token that must be a V register
+func (c *octoCompiler) nextRegister() (uint16, error) {
+	tok, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	x, ok := c.register(tok.text)
+	if !ok {
+		return 0, fmt.Errorf("expected a register, got %s", tok.text)
+	}
+	return x, nil
+}
+
+// define checks a new name is free
+func (c *octoCompiler) define(name string) error {
+	if !isOctoName(name) {
+		return fmt.Errorf("bad name %q", name)
+	}
+	if _, ok := c.register(name); ok {
+		return fmt.Errorf("%s is a register", name)
+	}
+	if _, ok := c.labels[name]; ok {
+		return fmt.Errorf("%s is already defined", name)
+	}
+	if _, ok := c.consts[name]; ok {
+		return fmt.Errorf("%s is already defined", name)
+	}
+	if _, ok := c.macros[name]; ok {
+		return fmt.Errorf("%s is already defined", name)
+	}
+	if octoKeywords[name] {
+		return fmt.Errorf("%s is a keyword", name)
+	}
+	return nil
+}
+
+func isOctoName(text string) bool {
+	if text == "" || !isIdentStart(rune(text[0])) {
+		return false
+	}
+	for _, ch := range text {
+		if !isIdentChar(ch) && ch != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// octoKeywords can't be used as names
+var octoKeywords = map[string]bool{
+	"clear": true, "return": true, "exit": true, "lores": true, "hires": true,
+	"scroll-down": true, "scroll-up": true, "scroll-left": true, "scroll-right": true,
+	"audio": true, "plane": true, "jump": true, "jump0": true, "i": true,
+	"delay": true, "buzzer": true, "pitch": true, "sprite": true, "bcd": true,
+	"save": true, "load": true, "saveflags": true, "loadflags": true, "if": true,
+	"then": true, "begin": true, "else": true, "end": true, "loop": true,
+	"again": true, "while": true, "key": true, "-key": true, "random": true,
+	"hex": true, "bighex": true, "long": true,
+}
+
+// statement compiles one statement
+func (c *octoCompiler) statement() error {
+	tok, err := c.next()
+	if err != nil {
+		return err
+	}
+	if macro, ok := c.macros[tok.text]; ok {
+		return c.expandMacro(macro)
+	}
+	if strings.HasPrefix(tok.text, ":") {
+		return c.directive(tok.text)
+	}
+	if x, ok := c.register(tok.text); ok {
+		return c.registerOp(x)
+	}
+	switch tok.text {
+	case "clear":
+		return c.emitOp(chip8.CLEAR)
+	case "return", ";":
+		return c.emitOp(chip8.RETURN)
+	case "exit":
+		return c.emitOp(chip8.EXIT)
+	case "lores":
+		return c.emitOp(chip8.LORES)
+	case "hires":
+		return c.emitOp(chip8.HIRES)
+	case "scroll-right":
+		return c.emitOp(chip8.SCROLL_RIGHT)
+	case "scroll-left":
+		return c.emitOp(chip8.SCROLL_LEFT)
+	case "audio":
+		return c.emitOp(0xF002)
+	case "scroll-down", "scroll-up":
+		n, err := c.value(0, 0xF)
+		if err != nil {
+			return err
+		}
+		if tok.text == "scroll-down" {
+			return c.emitOp(chip8.SCROLL_DOWN | n)
+		}
+		return c.emitOp(chip8.SCROLL_UP | n)
+	case "plane":
+		n, err := c.value(0, 0xF)
+		if err != nil {
+			return err
+		}
+		return c.emitOp(0xF001 | n<<8)
+	case "jump":
+		return c.emitAddrOp(0x1000)
+	case "jump0":
+		return c.emitAddrOp(0xB000)
+	case "i":
+		return c.indexOp()
+	case "delay", "buzzer", "pitch":
+		if err := c.expect(":="); err != nil {
+			return err
+		}
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		return c.emitOp(map[string]uint16{"delay": 0xF015, "buzzer": 0xF018, "pitch": 0xF03A}[tok.text] | x<<8)
+	case "sprite":
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		y, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		n, err := c.value(0, 0xF)
+		if err != nil {
+			return err
+		}
+		return c.emitOp(0xD000 | x<<8 | y<<4 | n)
+	case "bcd", "saveflags", "loadflags":
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		return c.emitOp(map[string]uint16{"bcd": 0xF033, "saveflags": 0xF075, "loadflags": 0xF085}[tok.text] | x<<8)
+	case "save", "load":
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		if c.peek() == "-" {
+			c.pos++
+			y, err := c.nextRegister()
+			if err != nil {
+				return err
+			}
+			if tok.text == "save" {
+				return c.emitOp(0x5002 | x<<8 | y<<4)
+			}
+			return c.emitOp(0x5003 | x<<8 | y<<4)
+		}
+		if tok.text == "save" {
+			return c.emitOp(0xF055 | x<<8)
+		}
+		return c.emitOp(0xF065 | x<<8)
+	case "if":
+		return c.ifStatement()
+	case "else":
+		if len(c.blocks) == 0 {
+			return fmt.Errorf("else without begin")
+		}
+		jump := c.here
+		if err := c.emitOp(0x1000); err != nil {
+			return err
+		}
+		c.patchJump(c.blocks[len(c.blocks)-1], c.here)
+		c.blocks[len(c.blocks)-1] = jump
+		return nil
+	case "end":
+		if len(c.blocks) == 0 {
+			return fmt.Errorf("end without begin")
+		}
+		c.patchJump(c.blocks[len(c.blocks)-1], c.here)
+		c.blocks = c.blocks[:len(c.blocks)-1]
+		return nil
+	case "loop":
+		c.loops = append(c.loops, octoLoop{start: c.here})
+		return nil
+	case "while":
+		if len(c.loops) == 0 {
+			return fmt.Errorf("while outside a loop")
+		}
+		skip, err := c.condition(true)
+		if err != nil {
+			return err
+		}
+		if err := c.emitOps(skip); err != nil {
+			return err
+		}
+		loop := &c.loops[len(c.loops)-1]
+		loop.breaks = append(loop.breaks, c.here)
+		return c.emitOp(0x1000)
+	case "again":
+		if len(c.loops) == 0 {
+			return fmt.Errorf("again without loop")
+		}
+		loop := c.loops[len(c.loops)-1]
+		c.loops = c.loops[:len(c.loops)-1]
+		if err := c.emitOp(0x1000 | loop.start); err != nil {
+			return err
+		}
+		for _, at := range loop.breaks {
+			c.patchJump(at, c.here)
+		}
+		return nil
+	}
+	// a label name calls the subroutine, whether it is defined yet or not
+	if _, ok := c.labels[tok.text]; ok {
+		return c.emitAddrOpFor(0x2000, tok)
+	}
+	if v, ok, err := c.constant(tok.text); err != nil || ok {
+		if err != nil {
+			return err
+		}
+		// a bare number or constant is a byte of data
+		if v < -128 || v > 0xFF {
+			return fmt.Errorf("byte %s is out of range", tok.text)
+		}
+		return c.emit(uint8(v))
+	}
+	if !isOctoName(tok.text) || octoKeywords[tok.text] {
+		return fmt.Errorf("unexpected %s", tok.text)
+	}
+	// any other name calls the subroutine with that label
+	return c.emitAddrOpFor(0x2000, tok)
+}
+
+func (c *octoCompiler) emitOps(ops []uint16) error {
+	for _, op := range ops {
+		if err := c.emitOp(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchJump points the jump at addr to target
+func (c *octoCompiler) patchJump(at, target uint16) {
+	c.mem[at] = 0x10 | uint8(target>>8&0xF)
+	c.mem[at+1] = uint8(target)
+}
+
+// directive compiles the : statements
+func (c *octoCompiler) directive(name string) error {
+	switch name {
+	case ":":
+		tok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if err := c.define(tok.text); err != nil {
+			return err
+		}
+		c.labels[tok.text] = c.here
+		return nil
+	case ":alias":
+		tok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if err := c.define(tok.text); err != nil {
+			return err
+		}
+		x, err := c.nextRegister()
+		if err != nil {
+			return err
+		}
+		c.aliases[tok.text] = x
+		return nil
+	case ":const":
+		tok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if err := c.define(tok.text); err != nil {
+			return err
+		}
+		valueTok, err := c.next()
+		if err != nil {
+			return err
+		}
+		v, ok, err := c.constant(valueTok.text)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("undefined constant %s", valueTok.text)
+		}
+		c.consts[tok.text] = float64(v)
+		return nil
+	case ":calc":
+		tok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if _, isConst := c.consts[tok.text]; !isConst {
+			if err := c.define(tok.text); err != nil {
+				return err
+			}
+		}
+		body, err := c.braces()
+		if err != nil {
+			return err
+		}
+		v, err := c.calc(body)
+		if err != nil {
+			return err
+		}
+		c.consts[tok.text] = v
+		return nil
+	case ":macro":
+		return c.defineMacro()
+	case ":breakpoint":
+		tok, err := c.next()
+		if err != nil {
+			return err
+		}
+		c.breakpoints[c.here] = tok.text
+		return nil
+	case ":org":
+		addr, err := c.value(0, chip8.MemoryBufferSize-1)
+		if err != nil {
+			return err
+		}
+		if addr < chip8.StartAddr {
+			return fmt.Errorf(":org 0x%X is below the program start", addr)
+		}
+		c.here = addr
+		return nil
+	case ":byte":
+		if c.peek() == "{" {
+			body, err := c.braces()
+			if err != nil {
+				return err
+			}
+			v, err := c.calc(body)
+			if err != nil {
+				return err
+			}
+			return c.emit(uint8(int64(math.Floor(v))))
+		}
+		v, err := c.byteValue()
+		if err != nil {
+			return err
+		}
+		return c.emit(uint8(v))
+	case ":call":
+		return c.emitAddrOp(0x2000)
+	case ":unpack":
+		// :unpack n label sets v0 to n<<4 | high nibble of label and v1 to
+		// its low byte
+		hi, err := c.value(0, 0xF)
+		if err != nil {
+			return err
+		}
+		addr, err := c.value(0, 0xFFF)
+		if err != nil {
+			return err
+		}
+		if err := c.emitOp(0x6000 | hi<<4 | addr>>8); err != nil {
+			return err
+		}
+		return c.emitOp(0x6100 | addr&0xFF)
+	}
+	return fmt.Errorf("unknown directive %s", name)
+}
+
+// braces reads the tokens of a { ... } group, braces may nest
+func (c *octoCompiler) braces() ([]octoToken, error) {
+	if err := c.expect("{"); err != nil {
+		return nil, err
+	}
+	var body []octoToken
+	for depth := 1; ; {
+		tok, err := c.next()
+		if err != nil {
+			return nil, fmt.Errorf("missing }")
+		}
+		switch tok.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth == 0 {
+			return body, nil
+		}
+		body = append(body, tok)
+	}
+}
+
+// defineMacro reads :macro name params... { body }
+func (c *octoCompiler) defineMacro() error {
+	tok, err := c.next()
+	if err != nil {
+		return err
+	}
+	if err := c.define(tok.text); err != nil {
+		return err
+	}
+	macro := &octoMacro{}
+	for c.peek() != "{" {
+		param, err := c.next()
+		if err != nil {
+			return err
+		}
+		macro.params = append(macro.params, param.text)
+	}
+	if macro.body, err = c.braces(); err != nil {
+		return err
+	}
+	c.macros[tok.text] = macro
+	return nil
+}
+
+// expandMacro reads the arguments of a macro call and splices the
+// substituted body into the token stream
+func (c *octoCompiler) expandMacro(macro *octoMacro) error {
+	c.macroDepth++
+	if c.macroDepth > maxMacroDepth {
+		return fmt.Errorf("macros expand too deeply")
+	}
+	args := map[string]string{}
+	for _, param := range macro.params {
+		arg, err := c.next()
+		if err != nil {
+			return err
+		}
+		args[param] = arg.text
+	}
+	body := make([]octoToken, len(macro.body))
+	for i, tok := range macro.body {
+		if arg, ok := args[tok.text]; ok {
+			tok.text = arg
+		}
+		body[i] = tok
+	}
+	// rest counts the tokens after the expansion, it stays fixed while
+	// nested expansions splice their own bodies in front of it
+	rest := len(c.toks) - c.pos
+	c.toks = append(c.toks[:c.pos:c.pos], append(body, c.toks[c.pos:]...)...)
+	for len(c.toks)-c.pos > rest {
+		if err := c.statement(); err != nil {
+			return err
+		}
+	}
+	c.macroDepth--
+	return nil
+}
@@ -0,0 +1,334 @@
+package asm
+
+import (
+	"fmt"
+	"math"
+)
+
+// registerOp compiles the statements that start with a V register
+func (c *octoCompiler) registerOp(x uint16) error {
+	op, err := c.next()
+	if err != nil {
+		return err
+	}
+	if op.text == ":=" {
+		switch c.peek() {
+		case "random":
+			c.pos++
+			nn, err := c.byteValue()
+			if err != nil {
+				return err
+			}
+			return c.emitOp(0xC000 | x<<8 | nn)
+		case "delay":
+			c.pos++
+			return c.emitOp(0xF007 | x<<8)
+		case "key":
+			c.pos++
+			return c.emitOp(0xF00A | x<<8)
+		}
+	}
+	if y, ok := c.register(c.peek()); ok {
+		c.pos++
+		logic, ok := map[string]uint16{
+			":=": 0x0, "|=": 0x1, "&=": 0x2, "^=": 0x3, "+=": 0x4,
+			"-=": 0x5, ">>=": 0x6, "=-": 0x7, "<<=": 0xE,
+		}[op.text]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", op.text)
+		}
+		return c.emitOp(0x8000 | x<<8 | y<<4 | logic)
+	}
+	switch op.text {
+	case ":=":
+		nn, err := c.byteValue()
+		return c.orErr(0x6000|x<<8|nn, err)
+	case "+=":
+		nn, err := c.byteValue()
+		return c.orErr(0x7000|x<<8|nn, err)
+	case "-=":
+		nn, err := c.byteValue()
+		return c.orErr(0x7000|x<<8|-nn&0xFF, err)
+	}
+	return fmt.Errorf("%s expects a register", op.text)
+}
+
+// orErr emits op unless err is set
+func (c *octoCompiler) orErr(op uint16, err error) error {
+	if err != nil {
+		return err
+	}
+	return c.emitOp(op)
+}
+
+// indexOp compiles the statements that assign or add to i
+func (c *octoCompiler) indexOp() error {
+	op, err := c.next()
+	if err != nil {
+		return err
+	}
+	if op.text == "+=" {
+		x, err := c.nextRegister()
+		return c.orErr(0xF01E|x<<8, err)
+	}
+	if op.text != ":=" {
+		return fmt.Errorf("unknown operator i %s", op.text)
+	}
+	switch c.peek() {
+	case "hex", "bighex":
+		kind := c.peek()
+		c.pos++
+		x, err := c.nextRegister()
+		if kind == "hex" {
+			return c.orErr(0xF029|x<<8, err)
+		}
+		return c.orErr(0xF030|x<<8, err)
+	case "long":
+		c.pos++
+		tok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if err := c.emitOp(0xF000); err != nil {
+			return err
+		}
+		v, ok, err := c.constant(tok.text)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if v < 0 || v > 0xFFFF {
+				return fmt.Errorf("address %s is out of range", tok.text)
+			}
+			return c.emitOp(uint16(v))
+		}
+		if !isOctoName(tok.text) {
+			return fmt.Errorf("expected an address, got %s", tok.text)
+		}
+		c.fixups = append(c.fixups, octoFixup{at: c.here, long: true, tok: tok})
+		return c.emitOp(0)
+	}
+	return c.emitAddrOp(0xA000)
+}
+
+// ifStatement compiles if <condition> then <statement> and
+// if <condition> begin ... [else ...] end
+func (c *octoCompiler) ifStatement() error {
+	start := c.pos
+	if _, err := c.condition(false); err != nil {
+		return err
+	}
+	kind, err := c.next()
+	if err != nil {
+		return err
+	}
+	c.pos = start
+	switch kind.text {
+	case "then":
+		// skip the statement when the condition is false
+		skip, _ := c.condition(false)
+		c.pos++
+		return c.emitOps(skip)
+	case "begin":
+		// skip the jump past the block when the condition is true
+		skip, _ := c.condition(true)
+		c.pos++
+		if err := c.emitOps(skip); err != nil {
+			return err
+		}
+		c.blocks = append(c.blocks, c.here)
+		return c.emitOp(0x1000)
+	}
+	return fmt.Errorf("expected then or begin, got %s", kind.text)
+}
+
+// condition reads <register> <comparison> [operand] and returns the
+// instructions that skip the next one when the condition equals skipWhen.
+// The ordered comparisons go through vf like Octo does
+func (c *octoCompiler) condition(skipWhen bool) ([]uint16, error) {
+	x, err := c.nextRegister()
+	if err != nil {
+		return nil, err
+	}
+	cmp, err := c.next()
+	if err != nil {
+		return nil, err
+	}
+	switch cmp.text {
+	case "key", "-key":
+		pressed := cmp.text == "key"
+		if pressed == skipWhen {
+			return []uint16{0xE09E | x<<8}, nil
+		}
+		return []uint16{0xE0A1 | x<<8}, nil
+	}
+	y, yIsReg := c.register(c.peek())
+	var nn uint16
+	if yIsReg {
+		c.pos++
+	} else if nn, err = c.byteValue(); err != nil {
+		return nil, err
+	}
+	switch cmp.text {
+	case "==", "!=":
+		equal := cmp.text == "=="
+		switch {
+		case equal == skipWhen && yIsReg:
+			return []uint16{0x5000 | x<<8 | y<<4}, nil
+		case yIsReg:
+			return []uint16{0x9000 | x<<8 | y<<4}, nil
+		case equal == skipWhen:
+			return []uint16{0x3000 | x<<8 | nn}, nil
+		}
+		return []uint16{0x4000 | x<<8 | nn}, nil
+	case "<", ">", "<=", ">=":
+	default:
+		return nil, fmt.Errorf("unknown comparison %s", cmp.text)
+	}
+	// every ordered comparison becomes a >= b, which is the not borrow flag
+	// left in vf by a subtraction, and whether that flag must be set
+	const vf = 0xF
+	a, b := x, y
+	if !yIsReg {
+		b = vf
+	}
+	if cmp.text == "<=" || cmp.text == ">" {
+		a, b = b, a
+	}
+	want := uint16(0)
+	if cmp.text == ">=" || cmp.text == "<=" {
+		want = 1
+	}
+	var ops []uint16
+	switch {
+	case !yIsReg && b == vf:
+		ops = []uint16{0x6F00 | nn, 0x8F07 | a<<4}
+	case !yIsReg:
+		ops = []uint16{0x6F00 | nn, 0x8F05 | b<<4}
+	default:
+		ops = []uint16{0x8F00 | a<<4, 0x8F05 | b<<4}
+	}
+	if skipWhen {
+		return append(ops, 0x3F00|want), nil
+	}
+	return append(ops, 0x4F00|want), nil
+}
+
+// calc evaluates a :calc expression. Like Octo there is no operator
+// precedence, binary operators group to the right so parentheses are needed
+// to evaluate left to right
+func (c *octoCompiler) calc(toks []octoToken) (float64, error) {
+	pos := 0
+	var expr, term func() (float64, error)
+	term = func() (float64, error) {
+		if pos < len(toks)-1 {
+			if unary, ok := calcUnary[toks[pos].text]; ok {
+				pos++
+				v, err := term()
+				return unary(v), err
+			}
+		}
+		return c.calcTerm(toks, &pos, expr)
+	}
+	expr = func() (float64, error) {
+		left, err := term()
+		if err != nil || pos >= len(toks) || toks[pos].text == ")" {
+			return left, err
+		}
+		binary, ok := calcBinary[toks[pos].text]
+		if !ok {
+			return 0, fmt.Errorf("unknown operator %s", toks[pos].text)
+		}
+		pos++
+		right, err := expr()
+		if err != nil {
+			return 0, err
+		}
+		return binary(left, right), nil
+	}
+	v, err := expr()
+	if err != nil {
+		return 0, err
+	}
+	if pos != len(toks) {
+		return 0, fmt.Errorf("unexpected %s in expression", toks[pos].text)
+	}
+	return v, nil
+}
+
+// calcTerm reads a number, name or parenthesised expression
+func (c *octoCompiler) calcTerm(toks []octoToken, pos *int, expr func() (float64, error)) (float64, error) {
+	if *pos >= len(toks) {
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+	tok := toks[*pos].text
+	*pos++
+	switch tok {
+	case "(":
+		v, err := expr()
+		if err != nil {
+			return 0, err
+		}
+		if *pos >= len(toks) || toks[*pos].text != ")" {
+			return 0, fmt.Errorf("missing )")
+		}
+		*pos++
+		return v, nil
+	case "HERE":
+		return float64(c.here), nil
+	case "PI":
+		return math.Pi, nil
+	case "E":
+		return math.E, nil
+	}
+	if v, ok := c.consts[tok]; ok {
+		return v, nil
+	}
+	v, ok, err := c.constant(tok)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("undefined name %s", tok)
+	}
+	return float64(v), nil
+}
+
+var calcUnary = map[string]func(float64) float64{
+	"-":     func(v float64) float64 { return -v },
+	"~":     func(v float64) float64 { return float64(^int64(v)) },
+	"!":     func(v float64) float64 { return bool2float(v == 0) },
+	"abs":   math.Abs,
+	"sqrt":  math.Sqrt,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+}
+
+var calcBinary = map[string]func(a, b float64) float64{
+	"+":   func(a, b float64) float64 { return a + b },
+	"-":   func(a, b float64) float64 { return a - b },
+	"*":   func(a, b float64) float64 { return a * b },
+	"/":   func(a, b float64) float64 { return a / b },
+	"%":   math.Mod,
+	"&":   func(a, b float64) float64 { return float64(int64(a) & int64(b)) },
+	"|":   func(a, b float64) float64 { return float64(int64(a) | int64(b)) },
+	"^":   func(a, b float64) float64 { return float64(int64(a) ^ int64(b)) },
+	"<<":  func(a, b float64) float64 { return float64(int64(a) << uint(b)) },
+	">>":  func(a, b float64) float64 { return float64(int64(a) >> uint(b)) },
+	"pow": math.Pow,
+	"min": math.Min,
+	"max": math.Max,
+	"<":   func(a, b float64) float64 { return bool2float(a < b) },
+	">":   func(a, b float64) float64 { return bool2float(a > b) },
+	"==":  func(a, b float64) float64 { return bool2float(a == b) },
+	"!=":  func(a, b float64) float64 { return bool2float(a != b) },
+}
+
+func bool2float(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package asm_test
+
+import (
+	"bytes"
+	"gochip8/internal/asm"
+	"gochip8/internal/disasm"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompileOcto(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		want []byte
+	}{
+		{
+			name: "call to a label defined later",
+			src:  ": main sub : sub return",
+			want: []byte{0x22, 0x02, 0x00, 0xEE},
+		},
+		{
+			// 0x200 jumps to main, sub follows the jump
+			name: "call to a label defined earlier",
+			src:  ": sub return : main sub",
+			want: []byte{0x12, 0x04, 0x00, 0xEE, 0x22, 0x02},
+		},
+		{
+			name: "constant is a data byte",
+			src:  ":const seven 7 : main seven 0x10",
+			want: []byte{0x07, 0x10},
+		},
+		{
+			name: "no main starts at the top",
+			src:  ": sub return",
+			want: []byte{0x00, 0xEE},
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			prog, err := asm.CompileOcto("test.8o", []byte(tc.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(prog.ROM, tc.want) {
+				t.Errorf("ROM = % X, want % X", prog.ROM, tc.want)
+			}
+		})
+	}
+}
+
+// TestOctoRoundTrip recompiles the Octo disassembly of the bundled ROMs
+func TestOctoRoundTrip(t *testing.T) {
+	for _, name := range []string{"test_opcode.ch8", "tetris.ch8", "particles.ch8"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			rom, err := os.ReadFile(filepath.Join("..", "..", "roms", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			src := disasm.Disassemble(rom, disasm.Options{Syntax: disasm.Octo})
+			prog, err := asm.CompileOcto(name, []byte(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(prog.ROM, rom) {
+				t.Errorf("recompiled ROM differs from %s", name)
+			}
+		})
+	}
+}
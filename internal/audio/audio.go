@@ -0,0 +1,155 @@
+// Package audio generates the chip8 buzzer tone and plays it through a
+// pluggable sink
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// SampleRate is the rate of the 16 bit mono samples given to sinks
+	SampleRate = 44100
+	// SamplesPerFrame is the number of samples rendered per 60 Hz frame
+	SamplesPerFrame = SampleRate / 60
+	// DefaultFrequency is the buzzer pitch in Hz
+	DefaultFrequency = 440
+	// DefaultVolume is the buzzer volume, from 0 for silence to 1
+	DefaultVolume = 0.25
+	// rampSamples is how long the tone takes to fade in and out, starting
+	// or stopping a wave abruptly is heard as a click
+	rampSamples = SampleRate / 200
+)
+
+// AudioSink plays the generated samples
+type AudioSink interface {
+	// Write queues 16 bit signed mono samples at SampleRate
+	Write(samples []int16) error
+	Close() error
+}
+
+// Waveform is the shape of the buzzer tone
+type Waveform int
+
+const (
+	Square Waveform = iota
+	Triangle
+	Sawtooth
+	Sine
+)
+
+var waveformNames = map[string]Waveform{
+	"square":   Square,
+	"triangle": Triangle,
+	"sawtooth": Sawtooth,
+	"sine":     Sine,
+}
+
+// WaveformNames lists the waveforms accepted by ParseWaveform
+func WaveformNames() []string {
+	return []string{"square", "triangle", "sawtooth", "sine"}
+}
+
+// ParseWaveform looks up a waveform by name
+func ParseWaveform(name string) (Waveform, error) {
+	w, ok := waveformNames[name]
+	if !ok {
+		return Square, fmt.Errorf("unknown waveform %q", name)
+	}
+	return w, nil
+}
+
+// sample returns the waveform at phase, which runs from 0 to 1 over a cycle
+func (w Waveform) sample(phase float64) float64 {
+	switch w {
+	case Triangle:
+		return 1 - 4*math.Abs(phase-0.5)
+	case Sawtooth:
+		return 2*phase - 1
+	case Sine:
+		return math.Sin(2 * math.Pi * phase)
+	}
+	if phase < 0.5 {
+		return 1
+	}
+	return -1
+}
+
+// Config describes the buzzer tone
+type Config struct {
+	Frequency float64
+	// Volume runs from 0 for silence to 1, NewBeeper clamps it to that
+	// range since louder samples would overflow
+	Volume   float64
+	Waveform Waveform
+}
+
+// DefaultConfig is a quiet 440 Hz square wave
+func DefaultConfig() Config {
+	return Config{Frequency: DefaultFrequency, Volume: DefaultVolume, Waveform: Square}
+}
+
+// Beeper renders the buzzer a frame at a time into a sink. The wave's phase
+// carries across frames and its level ramps up and down, so starting and
+// stopping the tone doesn't click
+type Beeper struct {
+	cfg  Config
+	sink AudioSink
+	// phase is the position in the current cycle, from 0 to 1
+	phase float64
+	// level is the envelope, 0 when silent and 1 at full volume
+	level float64
+	buf   []int16
+	// err is the first error from the sink, returned again by Close
+	err error
+}
+
+// NewBeeper creates a beeper writing to sink
+func NewBeeper(sink AudioSink, cfg Config) *Beeper {
+	switch {
+	case !(cfg.Volume > 0):
+		//NaN too
+		cfg.Volume = 0
+	case cfg.Volume > 1:
+		cfg.Volume = 1
+	}
+	return &Beeper{cfg: cfg, sink: sink, buf: make([]int16, SamplesPerFrame)}
+}
+
+// Frame renders one 60 Hz frame of audio with the tone sounding when on
+func (b *Beeper) Frame(on bool) error {
+	target := 0.0
+	if on {
+		target = 1
+	}
+	step := b.cfg.Frequency / SampleRate
+	for i := range b.buf {
+		switch {
+		case b.level < target:
+			b.level = math.Min(target, b.level+1.0/rampSamples)
+		case b.level > target:
+			b.level = math.Max(target, b.level-1.0/rampSamples)
+		}
+		if b.level == 0 {
+			// restart the wave from zero so the next beep fades in cleanly
+			b.phase = 0
+			b.buf[i] = 0
+			continue
+		}
+		v := b.cfg.Waveform.sample(b.phase) * b.level * b.cfg.Volume
+		b.buf[i] = int16(v * math.MaxInt16)
+		b.phase = math.Mod(b.phase+step, 1)
+	}
+	if err := b.sink.Write(b.buf); err != nil && b.err == nil {
+		b.err = err
+	}
+	return b.err
+}
+
+// Close closes the sink, reporting the first error any write returned
+func (b *Beeper) Close() error {
+	if err := b.sink.Close(); err != nil && b.err == nil {
+		b.err = err
+	}
+	return b.err
+}
@@ -0,0 +1,59 @@
+package audio_test
+
+import (
+	"gochip8/internal/audio"
+	"math"
+	"testing"
+)
+
+// recordSink keeps every sample written to it
+type recordSink struct {
+	samples []int16
+}
+
+func (s *recordSink) Write(samples []int16) error {
+	s.samples = append(s.samples, samples...)
+	return nil
+}
+
+func (s *recordSink) Close() error {
+	return nil
+}
+
+// peak returns the largest and smallest sample of a sounding square wave
+// played at volume
+func peak(t *testing.T, volume float64) (int16, int16) {
+	t.Helper()
+	sink := &recordSink{}
+	b := audio.NewBeeper(sink, audio.Config{Frequency: audio.DefaultFrequency, Volume: volume, Waveform: audio.Square})
+	for i := 0; i < 10; i++ {
+		if err := b.Frame(true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hi, lo := int16(0), int16(0)
+	for _, s := range sink.samples {
+		hi, lo = max(hi, s), min(lo, s)
+	}
+	return hi, lo
+}
+
+func TestVolumeIsClamped(t *testing.T) {
+	cases := []struct {
+		volume float64
+		hi     int16
+	}{
+		{0.5, math.MaxInt16 / 2},
+		{1, math.MaxInt16},
+		{3, math.MaxInt16},
+		{math.Inf(1), math.MaxInt16},
+		{-1, 0},
+		{math.NaN(), 0},
+	}
+	for _, tc := range cases {
+		hi, lo := peak(t, tc.volume)
+		if hi != tc.hi || lo != -tc.hi {
+			t.Errorf("volume %g peaks at %d and %d, want %d and %d", tc.volume, hi, lo, tc.hi, -tc.hi)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const wavHeaderSize = 44
+
+// WAVSink writes samples to a 16 bit mono PCM WAV file, for recording the
+// buzzer of headless runs
+type WAVSink struct {
+	w    io.WriteSeeker
+	size uint32
+}
+
+// NewWAVSink writes a WAV header to w. The sizes in the header are filled
+// in by Close, which doesn't close w
+func NewWAVSink(w io.WriteSeeker) (*WAVSink, error) {
+	s := &WAVSink{w: w}
+	if err := s.writeHeader(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *WAVSink) writeHeader() error {
+	var h [wavHeaderSize]byte
+	le := binary.LittleEndian
+	copy(h[0:], "RIFF")
+	le.PutUint32(h[4:], wavHeaderSize-8+s.size)
+	copy(h[8:], "WAVEfmt ")
+	le.PutUint32(h[16:], 16)           // fmt chunk size
+	le.PutUint16(h[20:], 1)            // PCM
+	le.PutUint16(h[22:], 1)            // mono
+	le.PutUint32(h[24:], SampleRate)   // sample rate
+	le.PutUint32(h[28:], SampleRate*2) // byte rate
+	le.PutUint16(h[32:], 2)            // block align
+	le.PutUint16(h[34:], 16)           // bits per sample
+	copy(h[36:], "data")
+	le.PutUint32(h[40:], s.size)
+	_, err := s.w.Write(h[:])
+	return err
+}
+
+// Write appends samples to the file
+func (s *WAVSink) Write(samples []int16) error {
+	if err := binary.Write(s.w, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	s.size += uint32(len(samples) * 2)
+	return nil
+}
+
+// Close rewrites the header with the final sizes
+func (s *WAVSink) Close() error {
+	if _, err := s.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	_, err := s.w.Seek(0, io.SeekEnd)
+	return err
+}
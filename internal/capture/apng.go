@@ -0,0 +1,130 @@
+package capture
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image/color"
+	"io"
+)
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// apngWriter writes the chunks of an APNG, keeping the sequence number
+// shared by the fcTL and fdAT chunks
+type apngWriter struct {
+	w   io.Writer
+	seq uint32
+	err error
+}
+
+// chunk writes a PNG chunk, the first error sticks
+func (a *apngWriter) chunk(typ string, data []byte) {
+	if a.err != nil {
+		return
+	}
+	head := make([]byte, 8)
+	binary.BigEndian.PutUint32(head, uint32(len(data)))
+	copy(head[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(head[4:])
+	crc.Write(data)
+	tail := binary.BigEndian.AppendUint32(nil, crc.Sum32())
+	for _, b := range [][]byte{head, data, tail} {
+		if _, a.err = a.w.Write(b); a.err != nil {
+			return
+		}
+	}
+}
+
+// next returns the next sequence number
+func (a *apngWriter) next() uint32 {
+	a.seq++
+	return a.seq - 1
+}
+
+// writeAPNG encodes the frames as a looping APNG with a 1 or 2-bit
+// palette. The first frame covers the whole canvas and doubles as the
+// still image shown by decoders without APNG support
+func writeAPNG(w io.Writer, width, height int, palette color.Palette, frames []animFrame) error {
+	depth := 1
+	if len(palette) > 2 {
+		depth = 2
+	}
+	a := &apngWriter{w: w}
+	if _, a.err = w.Write(pngSignature); a.err != nil {
+		return a.err
+	}
+
+	ihdr := binary.BigEndian.AppendUint32(nil, uint32(width))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(height))
+	//bit depth, indexed colour, deflate, adaptive filtering, no interlace
+	ihdr = append(ihdr, byte(depth), 3, 0, 0, 0)
+	a.chunk("IHDR", ihdr)
+	plte := []byte{}
+	for _, c := range palette {
+		rgb := color.NRGBAModel.Convert(c).(color.NRGBA)
+		plte = append(plte, rgb.R, rgb.G, rgb.B)
+	}
+	a.chunk("PLTE", plte)
+	//frame count, then 0 plays to loop forever
+	actl := binary.BigEndian.AppendUint32(nil, uint32(len(frames)))
+	a.chunk("acTL", binary.BigEndian.AppendUint32(actl, 0))
+
+	for i, f := range frames {
+		r := f.img.Rect
+		fctl := binary.BigEndian.AppendUint32(nil, a.next())
+		for _, v := range []int{r.Dx(), r.Dy(), r.Min.X, r.Min.Y} {
+			fctl = binary.BigEndian.AppendUint32(fctl, uint32(v))
+		}
+		//the delay is ticks/60 s, capped at the longest a frame can be
+		//shown, and the frame is kept on the canvas replacing the pixels
+		//under it
+		fctl = binary.BigEndian.AppendUint16(fctl, uint16(min(f.ticks, 0xFFFF)))
+		fctl = binary.BigEndian.AppendUint16(fctl, 60)
+		fctl = append(fctl, 0, 0)
+		a.chunk("fcTL", fctl)
+
+		data, err := compressFrame(f, depth)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			a.chunk("IDAT", data)
+		} else {
+			a.chunk("fdAT", append(binary.BigEndian.AppendUint32(nil, a.next()), data...))
+		}
+	}
+	a.chunk("IEND", nil)
+	return a.err
+}
+
+// compressFrame packs the palette indices of the frame depth bits at a time
+// into unfiltered scanlines and deflates them
+func compressFrame(f animFrame, depth int) ([]byte, error) {
+	img := f.img
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	perByte := 8 / depth
+	row := make([]byte, 1+(width+perByte-1)/perByte)
+	buf := &bytes.Buffer{}
+	zw := zlib.NewWriter(buf)
+	for y := 0; y < height; y++ {
+		for i := range row {
+			row[i] = 0
+		}
+		pix := img.Pix[y*img.Stride:]
+		for x := 0; x < width; x++ {
+			shift := 8 - depth*(x%perByte+1)
+			row[1+x/perByte] |= pix[x] << shift
+		}
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,281 @@
+// Package capture records the chip8 display to an animated GIF or APNG.
+//
+// A Recorder is a machine Display taking one frame per 60 Hz tick. Frames
+// that repeat the previous one only lengthen it and the rest are stored as
+// the rectangle that changed, drawn over the previous frame. The palette
+// holds just the plane bitmasks that appear, so most recordings are 1-bit.
+// APNG frames are timed in exact 60ths of a second, GIF delays are counted
+// in hundredths so they are rounded to keep every frame on the 60 Hz clock.
+// Frames are buffered in memory until Close encodes them, so recordings end
+// after MaxTicks
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"gochip8/internal/chip8"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format is an animated image format
+type Format int
+
+const (
+	GIF Format = iota
+	APNG
+)
+
+const (
+	// MaxTicks is the longest recording, 5 minutes of 60 Hz frames, later
+	// frames are dropped
+	MaxTicks = 5 * 60 * chip8.TimerFrequency
+	// maxCaptures bounds the search for a free capture filename
+	maxCaptures = 10000
+)
+
+// ErrNoFrames is returned when a recording is closed before any frame
+var ErrNoFrames = errors.New("no frames recorded")
+
+// FormatFor picks the format from the extension of path, .gif for GIF or
+// .png and .apng for APNG
+func FormatFor(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		return GIF, nil
+	case ".png", ".apng":
+		return APNG, nil
+	}
+	return 0, fmt.Errorf("can't record to %s, use a .gif, .png or .apng file", path)
+}
+
+// ext returns the filename extension of the format
+func (f Format) ext() string {
+	if f == APNG {
+		return ".png"
+	}
+	return ".gif"
+}
+
+// Options controls the encoded animation
+type Options struct {
+	// Scale draws each pixel as a Scale x Scale square, 0 is 1
+	Scale int
+	// Palette colours each pixel by plane bitmask, nil is chip8.GrayPalette
+	Palette color.Palette
+}
+
+// frame is a recorded display shown for ticks 60 Hz frames
+type frame struct {
+	pix           []uint8
+	width, height int
+	ticks         int
+}
+
+// Recorder buffers the displayed frames and encodes them on Close
+type Recorder struct {
+	w      io.Writer
+	closer io.Closer
+	format Format
+	opts   Options
+	frames []frame
+	ticks  int
+}
+
+// New creates a recorder encoding to w in format
+func New(w io.Writer, format Format, opts Options) *Recorder {
+	if opts.Scale < 1 {
+		opts.Scale = 1
+	}
+	if len(opts.Palette) <= chip8.PlaneMask {
+		opts.Palette = chip8.GrayPalette
+	}
+	return &Recorder{w: w, format: format, opts: opts}
+}
+
+// Create creates a recorder writing to path, in the format its extension
+// names. Close closes the file
+func Create(path string, opts Options) (*Recorder, error) {
+	format, err := FormatFor(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := New(f, format, opts)
+	r.closer = f
+	return r, nil
+}
+
+// CreateNext creates a recorder writing to the first unused chip8-NNNN
+// file in dir with the extension of format
+func CreateNext(dir string, format Format, opts Options) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	for n := 1; n < maxCaptures; n++ {
+		path := filepath.Join(dir, fmt.Sprintf("chip8-%04d%s", n, format.ext()))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		r := New(f, format, opts)
+		r.closer = f
+		return r, nil
+	}
+	return nil, fmt.Errorf("no free capture filename in %s", dir)
+}
+
+// Name returns the file being recorded to, or "" when not recording to a file
+func (r *Recorder) Name() string {
+	if f, ok := r.closer.(*os.File); ok {
+		return f.Name()
+	}
+	return ""
+}
+
+// Present records a width x height frame shown for one 60 Hz tick, as a
+// machine display. A frame matching the previous one lengthens it instead,
+// frames past MaxTicks are dropped
+func (r *Recorder) Present(buf []uint32, width, height int) {
+	if r.Full() {
+		return
+	}
+	r.ticks++
+	if n := len(r.frames); n > 0 {
+		last := &r.frames[n-1]
+		if last.width == width && last.height == height && samePixels(last.pix, buf) {
+			last.ticks++
+			return
+		}
+	}
+	pix := make([]uint8, width*height)
+	for i := range pix {
+		pix[i] = uint8(buf[i] & chip8.PlaneMask)
+	}
+	r.frames = append(r.frames, frame{pix, width, height, 1})
+}
+
+// samePixels reports whether the recorded pixels match the display buffer
+func samePixels(pix []uint8, buf []uint32) bool {
+	for i, p := range pix {
+		if uint32(p) != buf[i]&chip8.PlaneMask {
+			return false
+		}
+	}
+	return true
+}
+
+// Ticks returns the number of 60 Hz frames recorded
+func (r *Recorder) Ticks() int {
+	return r.ticks
+}
+
+// Full reports whether the recording reached MaxTicks
+func (r *Recorder) Full() bool {
+	return r.ticks >= MaxTicks
+}
+
+// Close encodes the recording and closes the file it was created with
+func (r *Recorder) Close() error {
+	err := r.encode()
+	if r.closer != nil {
+		if cerr := r.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// encode writes the animation in the recorder's format
+func (r *Recorder) encode() error {
+	if len(r.frames) == 0 {
+		return ErrNoFrames
+	}
+	width, height, palette, frames := r.build()
+	if r.format == APNG {
+		return writeAPNG(r.w, width, height, palette, frames)
+	}
+	return writeGIF(r.w, width, height, palette, frames)
+}
+
+// animFrame is an encoded frame, img covers the part of the canvas that
+// changed and is drawn over the previous frame
+type animFrame struct {
+	img   *image.Paletted
+	ticks int
+}
+
+// build lays the frames out on a canvas fitting the largest resolution
+// recorded, smaller ones are stretched, and crops each frame to what
+// changed since the previous one. The palette only holds the plane
+// bitmasks that appear
+func (r *Recorder) build() (int, int, color.Palette, []animFrame) {
+	width, height, used := 0, 0, [chip8.PlaneMask + 1]bool{}
+	for _, f := range r.frames {
+		width, height = max(width, f.width), max(height, f.height)
+		for _, p := range f.pix {
+			used[p] = true
+		}
+	}
+	var index [chip8.PlaneMask + 1]uint8
+	palette := color.Palette{}
+	for p, ok := range used {
+		if ok {
+			index[p] = uint8(len(palette))
+			palette = append(palette, r.opts.Palette[p])
+		}
+	}
+
+	scale := r.opts.Scale
+	var frames []animFrame
+	var prev []uint8
+	for _, f := range r.frames {
+		canvas := make([]uint8, width*height)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				canvas[y*width+x] = index[f.pix[(y*f.height/height)*f.width+x*f.width/width]]
+			}
+		}
+		rect := image.Rect(0, 0, width, height)
+		if prev != nil {
+			rect = changed(prev, canvas, width, height)
+			if rect.Empty() {
+				frames[len(frames)-1].ticks += f.ticks
+				continue
+			}
+		}
+		prev = canvas
+		img := image.NewPaletted(image.Rectangle{Min: rect.Min.Mul(scale), Max: rect.Max.Mul(scale)}, palette)
+		for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+				img.Pix[img.PixOffset(x, y)] = canvas[(y/scale)*width+x/scale]
+			}
+		}
+		frames = append(frames, animFrame{img, f.ticks})
+	}
+	return width * scale, height * scale, palette, frames
+}
+
+// changed returns the smallest rectangle holding every pixel that differs
+// between a and b
+func changed(a, b []uint8, width, height int) image.Rectangle {
+	rect := image.Rectangle{}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if a[y*width+x] != b[y*width+x] {
+				rect = rect.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return rect
+}
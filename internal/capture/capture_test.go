@@ -0,0 +1,31 @@
+package capture_test
+
+import (
+	"gochip8/internal/capture"
+	"io"
+	"testing"
+)
+
+func TestRecordingStopsAtMaxTicks(t *testing.T) {
+	r := capture.New(io.Discard, capture.GIF, capture.Options{})
+	//alternate two 1x1 frames so none are merged
+	for tick := 0; tick < capture.MaxTicks+10; tick++ {
+		if tick == capture.MaxTicks-1 && r.Full() {
+			t.Fatalf("full after %d ticks, before MaxTicks", r.Ticks())
+		}
+		r.Present([]uint32{uint32(tick % 2)}, 1, 1)
+	}
+	if !r.Full() || r.Ticks() != capture.MaxTicks {
+		t.Errorf("recorded %d ticks, full %t, want MaxTicks and full", r.Ticks(), r.Full())
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordingWithoutFrames(t *testing.T) {
+	r := capture.New(io.Discard, capture.APNG, capture.Options{})
+	if err := r.Close(); err != capture.ErrNoFrames {
+		t.Errorf("Close returned %v, want %v", err, capture.ErrNoFrames)
+	}
+}
@@ -0,0 +1,31 @@
+package capture
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+)
+
+// centiseconds returns the GIF timestamp of a 60 Hz tick, rounded to the
+// nearest hundredth of a second
+func centiseconds(tick int) int {
+	return (tick*100 + 30) / 60
+}
+
+// writeGIF encodes the frames as a looping GIF. Each delay is the rounded
+// timestamp of the frame's end less that of its start, so rounding errors
+// never add up
+func writeGIF(w io.Writer, width, height int, palette color.Palette, frames []animFrame) error {
+	anim := &gif.GIF{
+		Config: image.Config{ColorModel: palette, Width: width, Height: height},
+	}
+	tick := 0
+	for _, f := range frames {
+		anim.Image = append(anim.Image, f.img)
+		anim.Delay = append(anim.Delay, centiseconds(tick+f.ticks)-centiseconds(tick))
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+		tick += f.ticks
+	}
+	return gif.EncodeAll(w, anim)
+}
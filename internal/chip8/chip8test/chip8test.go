@@ -0,0 +1,248 @@
+// Package chip8test builds a chip8 in a described state, executes a single
+// opcode and checks the state it leaves behind, for table-driven opcode
+// tests. Expectations are written as a diff: whatever a case doesn't
+// mention must be as it was set up
+package chip8test
+
+import (
+	"errors"
+	"fmt"
+	"gochip8/internal/chip8"
+	"gochip8/internal/clog"
+	"sort"
+	"testing"
+)
+
+// Regs sets or expects V registers by index
+type Regs map[uint8]uint8
+
+// Mem sets or expects memory, each entry holds bytes starting at its address
+type Mem map[uint16][]byte
+
+// Point is a display pixel
+type Point struct{ X, Y int }
+
+// State describes the parts of a chip8 a case sets up or expects, nil
+// fields are left as they are
+type State struct {
+	V  Regs
+	I  *uint16
+	PC *uint16
+	// Stack holds the return addresses from the outermost call in
+	Stack  []uint16
+	Delay  *uint8
+	Sound  *uint8
+	Memory Mem
+	// Lit lists every lit pixel on the display
+	Lit []Point
+}
+
+// Addr returns a pointer to v, for the I and PC fields of State
+func Addr(v uint16) *uint16 {
+	return &v
+}
+
+// Byte returns a pointer to v, for the timer fields of State
+func Byte(v uint8) *uint8 {
+	return &v
+}
+
+// Case executes Op on a chip8 set up as Setup and compares the result with
+// Want. Unless Want says otherwise the program counter must have moved on
+// to the next instruction, or stayed put when the opcode faulted
+type Case struct {
+	Name   string
+	Quirks chip8.Quirks
+	// Hires switches to the 128x64 display before setting up
+	Hires bool
+	// Keys are held down while the opcode executes
+	Keys []uint8
+	// Random is the byte CXNN draws
+	Random uint8
+	Setup  State
+	Op     uint16
+	Want   State
+	// Err is the fault Op must raise under the strict error policy,
+	// matched with errors.Is
+	Err           error
+	Halted        bool
+	WaitingForKey bool
+}
+
+// fixedRNG always draws the same byte
+type fixedRNG uint8
+
+func (fixedRNG) Seed(int64) {}
+
+func (r fixedRNG) Byte() uint8 {
+	return uint8(r)
+}
+
+// Run runs every case as a subtest
+func Run(t *testing.T, cases []Case) {
+	t.Helper()
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.Name, tc.Run)
+	}
+}
+
+// Run executes the case and reports every difference from Want
+func (tc Case) Run(t *testing.T) {
+	t.Helper()
+	c := tc.setup()
+	before := c.GetRegisterState()
+	beforeLit := litPixels(c)
+	err := c.ExecuteOpcode(tc.Op)
+	if !errors.Is(err, tc.Err) {
+		t.Errorf("%04X returned %v, want %v", tc.Op, err, tc.Err)
+	}
+	after := c.GetRegisterState()
+
+	for v := range after.V {
+		want, ok := tc.Want.V[uint8(v)]
+		if !ok {
+			want = before.V[v]
+		}
+		if after.V[v] != want {
+			t.Errorf("V%X = 0x%02X, want 0x%02X", v, after.V[v], want)
+		}
+	}
+	checkWord(t, "I", after.I, tc.Want.I, before.I)
+	nextPC := before.PC + 2
+	if tc.Err != nil {
+		nextPC = before.PC
+	}
+	checkWord(t, "PC", after.PC, tc.Want.PC, nextPC)
+	wantStack := before.Stack[1 : before.SP+1]
+	if tc.Want.Stack != nil {
+		wantStack = tc.Want.Stack
+	}
+	if got := after.Stack[1 : after.SP+1]; fmt.Sprint(got) != fmt.Sprint(wantStack) {
+		t.Errorf("stack = %X, want %X", got, wantStack)
+	}
+	checkByte(t, "delay timer", after.Delay, tc.Want.Delay, before.Delay)
+	checkByte(t, "sound timer", after.Sound, tc.Want.Sound, before.Sound)
+	for addr, want := range tc.Want.Memory {
+		for i, b := range want {
+			if got := c.ReadMemory(addr + uint16(i)); got != b {
+				t.Errorf("memory[0x%03X] = 0x%02X, want 0x%02X", addr+uint16(i), got, b)
+			}
+		}
+	}
+	wantLit := beforeLit
+	if tc.Want.Lit != nil {
+		wantLit = sortPoints(tc.Want.Lit)
+	}
+	if got := litPixels(c); fmt.Sprint(got) != fmt.Sprint(wantLit) {
+		t.Errorf("lit pixels = %v, want %v", got, wantLit)
+	}
+	if after.Halted != tc.Halted {
+		t.Errorf("halted = %t, want %t", after.Halted, tc.Halted)
+	}
+	if after.WaitingForKey != tc.WaitingForKey {
+		t.Errorf("waiting for key = %t, want %t", after.WaitingForKey, tc.WaitingForKey)
+	}
+}
+
+// setup creates a silent, strict chip8 in the state the case describes
+func (tc Case) setup() *chip8.Chip8 {
+	c := chip8.Init(tc.Quirks)
+	c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+	c.SetErrorPolicy(chip8.Strict)
+	c.SetRNG(fixedRNG(tc.Random))
+	if tc.Hires {
+		c.ExecuteOpcode(0x00FF)
+		c.SetProgramCounter(chip8.StartAddr)
+	}
+	s := tc.Setup
+	for v, val := range s.V {
+		c.SetVRegister(v, val)
+	}
+	if s.I != nil {
+		c.SetIRegister(*s.I)
+	}
+	if s.PC != nil {
+		c.SetProgramCounter(*s.PC)
+	}
+	c.SetStack(s.Stack)
+	if s.Delay != nil {
+		c.SetDelayTimer(*s.Delay)
+	}
+	if s.Sound != nil {
+		c.SetSoundTimer(*s.Sound)
+	}
+	for addr, data := range s.Memory {
+		for i, b := range data {
+			c.WriteMemory(addr+uint16(i), b)
+		}
+	}
+	width, height := c.GetDisplaySize()
+	buf := make([]uint32, width*height)
+	for _, p := range s.Lit {
+		buf[p.Y*width+p.X] = 1
+	}
+	c.SetDisplayBuffer(buf)
+	for _, k := range tc.Keys {
+		c.KeyDown(k)
+	}
+	return c
+}
+
+// litPixels lists the lit pixels of the display in reading order
+func litPixels(c *chip8.Chip8) []Point {
+	width, _ := c.GetDisplaySize()
+	lit := []Point{}
+	for i, p := range c.GetDisplayBuffer() {
+		if p&chip8.PlaneMask != 0 {
+			lit = append(lit, Point{i % width, i / width})
+		}
+	}
+	return lit
+}
+
+// sortPoints returns the points in reading order
+func sortPoints(points []Point) []Point {
+	sorted := append([]Point{}, points...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Y != sorted[j].Y {
+			return sorted[i].Y < sorted[j].Y
+		}
+		return sorted[i].X < sorted[j].X
+	})
+	return sorted
+}
+
+func checkWord(t *testing.T, name string, got uint16, want *uint16, unchanged uint16) {
+	t.Helper()
+	if want != nil {
+		unchanged = *want
+	}
+	if got != unchanged {
+		t.Errorf("%s = 0x%03X, want 0x%03X", name, got, unchanged)
+	}
+}
+
+func checkByte(t *testing.T, name string, got uint8, want *uint8, unchanged uint8) {
+	t.Helper()
+	if want != nil {
+		unchanged = *want
+	}
+	if got != unchanged {
+		t.Errorf("%s = %d, want %d", name, got, unchanged)
+	}
+}
+
+// Screen returns the lit pixels of an ASCII drawing where # is lit, with
+// the top left corner at (x, y), so sprites can be written out in cases
+func Screen(x, y int, rows ...string) []Point {
+	lit := []Point{}
+	for dy, row := range rows {
+		for dx := 0; dx < len(row); dx++ {
+			if row[dx] == '#' {
+				lit = append(lit, Point{x + dx, y + dy})
+			}
+		}
+	}
+	return lit
+}
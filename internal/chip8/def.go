@@ -1,15 +1,24 @@
 package chip8
 
-import "gochip8/internal/clog"
+import (
+	"gochip8/internal/clog"
+	"time"
+)
 
 const (
-	StartAddr        = 0x200
-	FontsetStartAddr = 0x50
-	VF               = 0xF
-
-	VideoBufferWidth  = 64
-	VideoBufferHeight = 32
-	MemoryBufferSize  = 4096
+	StartAddr           = 0x200
+	FontsetStartAddr    = 0x50
+	BigFontsetStartAddr = 0xA0
+	VF                  = 0xF
+
+	VideoBufferWidth       = 64
+	VideoBufferHeight      = 32
+	HiResVideoBufferWidth  = 128
+	HiResVideoBufferHeight = 64
+	MemoryBufferSize       = 0x10000
+	SmallMemorySize        = 0x1000
+	PlaneMask              = 0x3
+	DefaultPitch           = 64
 )
 
 var fontset = [80]byte{
@@ -31,16 +40,42 @@ var fontset = [80]byte{
 	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
 }
 
+// bigFontset holds the SUPER-CHIP 8x10 digits used by FX30
+var bigFontset = [160]byte{
+	0xFF, 0xFF, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, // 0
+	0x18, 0x78, 0x78, 0x18, 0x18, 0x18, 0x18, 0x18, 0xFF, 0xFF, // 1
+	0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // 2
+	0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 3
+	0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0x03, 0x03, // 4
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 5
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 6
+	0xFF, 0xFF, 0x03, 0x03, 0x06, 0x0C, 0x18, 0x18, 0x18, 0x18, // 7
+	0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 8
+	0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 9
+	0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, // A
+	0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, // B
+	0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C, // C
+	0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, // D
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // E
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, // F
+}
+
 type Registers struct {
-	iRegister uint16
-	vRegister [16]uint8
-	delay     uint8
-	sound     uint8
+	iRegister    uint16
+	vRegister    [16]uint8
+	delay        uint8
+	sound        uint8
+	audioPattern [16]uint8
+	pitch        uint8
 }
 
 // Memory is the RAM for the chip8 emulator
 type Memory struct {
 	buf [MemoryBufferSize]uint8
+	// size is the address space of the quirks profile, accesses beyond it
+	// still reach buf but set outOfBounds
+	size        uint32
+	outOfBounds bool
 }
 
 // Stack is the stack for the chip8 emulator
@@ -50,9 +85,13 @@ type Stack struct {
 	stackPointer   uint16
 }
 
-// FrameBuf is the buffer for the video display
+// FrameBuf is the buffer for the video display, sized for the active resolution.
+// Each pixel holds the bitmask of XO-CHIP planes lit at that position
 type FrameBuf struct {
-	buf [2048]uint32
+	buf    []uint32
+	width  uint16
+	height uint16
+	planes uint8
 }
 
 // Opcode is the type for opcodes
@@ -88,6 +127,51 @@ func (o Opcode) nnn() uint16 {
 	return uint16(o & 0x0FFF)
 }
 
+// RegisterState is a snapshot of the registers for hosts and tools
+type RegisterState struct {
+	V      [16]uint8  `json:"v"`
+	I      uint16     `json:"i"`
+	PC     uint16     `json:"pc"`
+	SP     uint16     `json:"sp"`
+	Stack  [16]uint16 `json:"stack"`
+	Delay  uint8      `json:"delay"`
+	Sound  uint8      `json:"sound"`
+	Ticks  int64      `json:"ticks"`
+	Halted bool       `json:"halted"`
+	// WaitingForKey is set while FX0A blocks for input
+	WaitingForKey bool `json:"waiting_for_key"`
+}
+
+// Op returns the top level instruction, for use outside the package
+func (o Opcode) Op() uint16 {
+	return o.opDecode()
+}
+
+// X returns the index of the vx register
+func (o Opcode) X() uint16 {
+	return o.vx()
+}
+
+// Y returns the index of the vy register
+func (o Opcode) Y() uint16 {
+	return o.vy()
+}
+
+// N returns the last nibble of the opcode
+func (o Opcode) N() uint8 {
+	return o.n()
+}
+
+// NN returns the last byte of the opcode
+func (o Opcode) NN() uint8 {
+	return o.nn()
+}
+
+// NNN returns the address in the last 12 bits of the opcode
+func (o Opcode) NNN() uint16 {
+	return o.nnn()
+}
+
 // Chip8 struct for the chip8 emulator
 type Chip8 struct {
 	registers *Registers
@@ -95,22 +179,44 @@ type Chip8 struct {
 	stack     *Stack
 	frameBuf  *FrameBuf
 	keys      [16]uint8
-	opcode    Opcode
+	// keyPressed and keyReleased hold the key transitions of the current
+	// frame as bitmasks, so a tap shorter than a frame is still seen
+	keyPressed  uint16
+	keyReleased uint16
+	opcode      Opcode
+	opcodeAddr  uint16
+	quirks      Quirks
+	rplFlags    [16]uint8
+	halted      bool
+	romHash     [32]byte
+	// beeping records whether the sound timer ran during the last frame
+	beeping bool
+	keyWait keyWait
+	seed    int64
+	rng     RNG
+	rngName string
+	policy  ErrorPolicy
+	// fault stops a strict chip8 until the machine state is restored
+	fault error
 
 	//For testing
 	logger *clog.Log
 	ticks  int64
 }
 
-// Init initializes the chip8 emulator
-func Init() *Chip8 {
+// Init initializes the chip8 emulator with the given quirks profile
+func Init(quirks Quirks) *Chip8 {
 	c := &Chip8{
 		registers: InitRegisters(),
 		stack:     InitStack(),
 		memory:    InitMemory(),
 		frameBuf:  InitFrameBuf(),
 		keys:      [16]uint8{},
+		quirks:    quirks,
 		logger:    clog.NewLog(int(clog.LogLevelInfo), "Chip8", "c8-cpu"),
 	}
+	c.memory.size = quirks.addressSpace()
+	c.rng, c.rngName = NewRNG(), DefaultRNG
+	c.SetSeed(time.Now().UnixNano())
 	return c
 }
@@ -0,0 +1,69 @@
+package chip8
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrStackOverflow is raised by a 2NNN call with all StackDepth levels in use
+	ErrStackOverflow = errors.New("stack overflow")
+	// ErrStackUnderflow is raised by a 00EE return with nothing on the stack
+	ErrStackUnderflow = errors.New("stack underflow")
+	// ErrMemoryOutOfBounds is raised by an access past the address space of
+	// the quirks profile, 4K unless LargeMemory is set
+	ErrMemoryOutOfBounds = errors.New("memory access out of bounds")
+	// ErrROMTooLarge is returned by Load for a ROM that doesn't fit in
+	// memory above StartAddr
+	ErrROMTooLarge = errors.New("ROM does not fit in memory")
+)
+
+// ErrInvalidOpcode is raised by an opcode no interpreter defines
+type ErrInvalidOpcode struct {
+	PC uint16
+	Op Opcode
+}
+
+func (e ErrInvalidOpcode) Error() string {
+	return fmt.Sprintf("invalid opcode %04X at 0x%03X", uint16(e.Op), e.PC)
+}
+
+// ErrorPolicy decides what happens when a program faults
+type ErrorPolicy int
+
+const (
+	// Lenient carries on the way most interpreters do: invalid opcodes,
+	// calls with the stack full and returns with it empty are skipped and
+	// memory past the address space is still accessed. Faults are only
+	// logged
+	Lenient ErrorPolicy = iota
+	// Strict stops the chip8 at the faulting instruction, Cycle returns the
+	// fault until a save state or rewind frame is restored
+	Strict
+)
+
+// fail records a fault raised by the current instruction, wrapped with
+// its address
+func (c *Chip8) fail(err error) {
+	if c.fault == nil {
+		c.fault = fmt.Errorf("%w at 0x%03X", err, c.opcodeAddr)
+	}
+}
+
+// invalidOpcode records the current opcode as invalid
+func (c *Chip8) invalidOpcode() {
+	if c.fault == nil {
+		c.fault = ErrInvalidOpcode{PC: c.opcodeAddr, Op: c.opcode}
+	}
+}
+
+// public method for external pkg to choose how faults are handled, the
+// default is Lenient
+func (c *Chip8) SetErrorPolicy(policy ErrorPolicy) {
+	c.policy = policy
+}
+
+// public method for external pkg to get how faults are handled
+func (c *Chip8) ErrorPolicy() ErrorPolicy {
+	return c.policy
+}
@@ -1,6 +1,6 @@
 package chip8
 
-import "log"
+import "fmt"
 
 const (
 	T0             = 0x00
@@ -20,8 +20,15 @@ const (
 	TE             = 0x0E
 	TF             = 0x0F
 
-	CLEAR  = 0xE0
-	RETURN = 0xEE
+	CLEAR        = 0xE0
+	RETURN       = 0xEE
+	SCROLL_DOWN  = 0xC0
+	SCROLL_UP    = 0xD0
+	SCROLL_RIGHT = 0xFB
+	SCROLL_LEFT  = 0xFC
+	EXIT         = 0xFD
+	LORES        = 0xFE
+	HIRES        = 0xFF
 
 	COPY_V_REGISTER = 0x0
 	OR_V_REGISTER   = 0x1
@@ -33,18 +40,29 @@ const (
 	DIFF_V_REGISTER = 0x7
 	SHIFT_LEFT      = 0xE
 
+	SKIP_VX_EQ_VY_ALT = 0x0
+	SAVE_VX_VY        = 0x2
+	LOAD_VX_VY        = 0x3
+
 	SKIP_ON_KEY_PRESSED  = 0x9E
 	SKIP_ON_KEY_RELEASED = 0xA1
 
-	SET_VX_DELAY_TIMER = 0x07
-	WAIT_FOR_KEY       = 0x0A
-	SET_DELAY_TIMER_VX = 0x15
-	SET_SOUND_TIMER    = 0x18
-	ADD_VX_TO_I        = 0x1E
-	SET_I_TO_SPRITE    = 0x29
-	SET_BCD            = 0x33
-	REG_DUMP           = 0x55
-	READ_REGISTERS     = 0x65
+	LOAD_LONG_I         = 0x00
+	SELECT_PLANE        = 0x01
+	LOAD_AUDIO_PATTERN  = 0x02
+	SET_VX_DELAY_TIMER  = 0x07
+	WAIT_FOR_KEY        = 0x0A
+	SET_DELAY_TIMER_VX  = 0x15
+	SET_SOUND_TIMER     = 0x18
+	ADD_VX_TO_I         = 0x1E
+	SET_I_TO_SPRITE     = 0x29
+	SET_I_TO_BIG_SPRITE = 0x30
+	SET_BCD             = 0x33
+	SET_PITCH           = 0x3A
+	REG_DUMP            = 0x55
+	READ_REGISTERS      = 0x65
+	SAVE_RPL_FLAGS      = 0x75
+	LOAD_RPL_FLAGS      = 0x85
 )
 
 // executeCurrentInstruction decodes & executes the current opcode
@@ -63,24 +81,23 @@ func (c *Chip8) executeCurrentInstruction() {
 		c.stack.setProgramCounter(nnn)
 	case SUBROUTINE:
 		//Call subroutine at nnn
-		c.stack.incrementStackPointer()
-		c.stack.setCurStackVal(c.stack.getProgramCounter())
+		if !c.stack.push(c.stack.getProgramCounter()) {
+			c.fail(ErrStackOverflow)
+			return
+		}
 		c.stack.setProgramCounter(nnn)
 	case SKIP_EQ:
 		//Skip next instruction if Vx = nn
 		if c.registers.getVRegisterVal(vx) == nn {
-			c.stack.incrementProgramCounter()
+			c.skipNextInstruction()
 		}
 	case SKIP_NEQ:
 		//Skip next instruction if Vx != nn
 		if c.registers.getVRegisterVal(vx) != nn {
-			c.stack.incrementProgramCounter()
+			c.skipNextInstruction()
 		}
 	case SKIP_VX_EQ_VY:
-		//Skip next instruction if Vx = Vy
-		if c.registers.areVRegistersEqual(vx, vy) {
-			c.stack.incrementProgramCounter()
-		}
+		c.executeInstructionType5(vx, vy, n)
 	case SET_VX_NN:
 		//Set Vx = nn
 		c.registers.setVRegister(vx, nn)
@@ -93,12 +110,17 @@ func (c *Chip8) executeCurrentInstruction() {
 	case SKIP_VX_NEQ_VY:
 		//Skip next instruction if Vx != Vy
 		if !c.registers.areVRegistersEqual(vx, vy) {
-			c.stack.incrementProgramCounter()
+			c.skipNextInstruction()
 		}
 	case SET_I_NNN:
 		//Set I = nnn
 		c.registers.setIRegister(nnn)
 	case JMP_NNN_V0:
+		if c.quirks.JumpUsesVx {
+			//Jump to location xnn + Vx
+			c.stack.setProgramCounter(nnn + uint16(c.registers.getVRegisterVal(vx)))
+			return
+		}
 		//Jump to location nnn + V0
 		c.stack.setProgramCounter(nnn + uint16(c.registers.getVRegisterVal(0)))
 	case RAND_NN_MASK:
@@ -106,51 +128,161 @@ func (c *Chip8) executeCurrentInstruction() {
 		c.registers.setVRegister(vx, c.rand()&nn)
 	case DRAW:
 		//Display n-byte sprite starting at memory location I at (Vx, Vy), set VF = collision
-		height := n
-		xPos := c.registers.getVRegisterVal(vx) % VideoBufferWidth
-		yPos := c.registers.getVRegisterVal(vy) % VideoBufferHeight
-		c.registers.clearVRegister(VF)
-		fb := c.frameBuf.getFrameBuffer()
-		for row := uint16(0); row < uint16(height); row++ {
-			p := c.memory.read(c.registers.getIRegister() + row)
-			for col := uint16(0); col < 8; col++ {
-				if (p & (0x80 >> col)) == 0 {
+		c.drawSprite(vx, vy, n)
+	case TE:
+		c.executeInstructionTypeE(vx, nn)
+	case TF:
+		c.executeInstructionTypeF(vx, nn)
+	default:
+		c.invalidOpcode()
+	}
+
+}
+
+// drawSprite xors a sprite from memory at I onto the selected planes at (Vx, Vy).
+// n rows of 8 pixels are drawn, or a 16x16 sprite when n is 0. When both planes
+// are selected the second plane's sprite data follows the first's in memory
+func (c *Chip8) drawSprite(vx, vy uint16, n uint8) {
+	width, height := uint16(8), uint16(n)
+	if n == 0 {
+		width, height = 16, 16
+	}
+	bytesPerRow := width / 8
+	screenWidth := c.frameBuf.getWidth()
+	screenHeight := c.frameBuf.getHeight()
+	xPos := uint16(c.registers.getVRegisterVal(vx)) % screenWidth
+	yPos := uint16(c.registers.getVRegisterVal(vy)) % screenHeight
+	c.registers.clearVRegister(VF)
+	addr := c.registers.getIRegister()
+	for plane := uint8(1); plane <= PlaneMask; plane <<= 1 {
+		if c.frameBuf.getPlanes()&plane == 0 {
+			continue
+		}
+		for row := uint16(0); row < height; row++ {
+			var p uint16
+			for b := uint16(0); b < bytesPerRow; b++ {
+				p = p<<8 | uint16(c.memory.read(addr+row*bytesPerRow+b))
+			}
+			y := yPos + row
+			if y >= screenHeight {
+				if c.quirks.ClipSprites {
+					continue
+				}
+				y %= screenHeight
+			}
+			for col := uint16(0); col < width; col++ {
+				if (p & (1 << (width - 1 - col))) == 0 {
 					continue
 				}
-				displayIndex := (uint16(yPos)+row)*VideoBufferWidth + (uint16(xPos) + col)
-				screenPixel := fb[displayIndex]
-				if screenPixel == 0xFFFFFFFF {
+				x := xPos + col
+				if x >= screenWidth {
+					if c.quirks.ClipSprites {
+						break
+					}
+					x %= screenWidth
+				}
+				displayIndex := y*screenWidth + x
+				if c.frameBuf.getPixel(displayIndex)&uint32(plane) != 0 {
 					c.registers.setVRegister(VF, 1)
 				}
-				c.frameBuf.setPixel(displayIndex)
+				c.frameBuf.flipPixel(displayIndex, plane)
 			}
 		}
-	case TE:
-		c.executeInstructionTypeE(vx, nn)
-	case TF:
-		c.executeInstructionTypeF(vx, nn)
-	default:
-		c.no_op()
+		addr += height * bytesPerRow
 	}
+}
 
+// skipNextInstruction advances the program counter past the next instruction,
+// which is 4 bytes long when it is the XO-CHIP F000 NNNN long load
+func (c *Chip8) skipNextInstruction() {
+	pc := c.stack.getProgramCounter()
+	if c.memory.read(pc) == 0xF0 && c.memory.read(pc+1) == 0x00 {
+		c.stack.incrementProgramCounter()
+	}
+	c.stack.incrementProgramCounter()
 }
 
 // executeInstructionType0 executes sub instruction for type 0 instructions
 func (c *Chip8) executeInstructionType0(instruction uint8) {
+	switch instruction & 0xF0 {
+	case SCROLL_DOWN:
+		//Scroll the display down n rows
+		c.frameBuf.scrollDown(uint16(instruction & 0x0F))
+		return
+	case SCROLL_UP:
+		//Scroll the display up n rows
+		c.frameBuf.scrollUp(uint16(instruction & 0x0F))
+		return
+	}
 	switch instruction {
 	case CLEAR:
 		//Clear the display
 		c.frameBuf.clear()
 	case RETURN:
 		//Return from a subroutine
-		c.stack.setProgramCounter(c.stack.getCurStackVal())
-		c.stack.decrementStackPointer()
-		log.Println("Returning to location: ", c.stack.getCurStackVal())
+		if !c.stack.pop() {
+			c.fail(ErrStackUnderflow)
+		}
+		c.logger.Info().Msg(fmt.Sprintf("Returning to location: %d", c.stack.getCurStackVal()))
+	case SCROLL_RIGHT:
+		//Scroll the display right 4 columns
+		c.frameBuf.scrollRight(4)
+	case SCROLL_LEFT:
+		//Scroll the display left 4 columns
+		c.frameBuf.scrollLeft(4)
+	case EXIT:
+		//Stop the interpreter
+		c.halted = true
+	case LORES:
+		//Switch to the 64x32 display
+		c.frameBuf.setResolution(false)
+	case HIRES:
+		//Switch to the 128x64 display
+		c.frameBuf.setResolution(true)
+	default:
+		c.invalidOpcode()
+	}
+}
+
+// executeInstructionType5 executes sub instruction for type 5 instructions
+func (c *Chip8) executeInstructionType5(vx, vy uint16, instruction uint8) {
+	switch instruction {
+	case SKIP_VX_EQ_VY_ALT:
+		//Skip next instruction if Vx = Vy
+		if c.registers.areVRegistersEqual(vx, vy) {
+			c.skipNextInstruction()
+		}
+	case SAVE_VX_VY:
+		//Store registers Vx through Vy in memory starting at location I
+		iReg := c.registers.getIRegister()
+		for i, reg := range registerRange(vx, vy) {
+			c.memory.write(iReg+uint16(i), c.registers.getVRegisterVal(reg))
+		}
+	case LOAD_VX_VY:
+		//Read registers Vx through Vy from memory starting at location I
+		iReg := c.registers.getIRegister()
+		for i, reg := range registerRange(vx, vy) {
+			c.registers.setVRegister(reg, c.memory.read(iReg+uint16(i)))
+		}
 	default:
-		c.no_op()
+		c.invalidOpcode()
 	}
 }
 
+// registerRange lists the registers from vx to vy inclusive, counting down when vx > vy
+func registerRange(vx, vy uint16) []uint16 {
+	regs := []uint16{vx}
+	for reg := vx; reg != vy; {
+		if vx < vy {
+			reg++
+		} else {
+			reg--
+		}
+		regs = append(regs, reg)
+	}
+	return regs
+}
+
 // executeInstructionType8 executes sub instruction for type 8 instructions
 func (c *Chip8) executeInstructionType8(vx, vy uint16, instruction uint8) {
 	switch instruction {
@@ -160,49 +292,62 @@ func (c *Chip8) executeInstructionType8(vx, vy uint16, instruction uint8) {
 	case OR_V_REGISTER:
 		//Set Vx = Vx OR Vy
 		c.registers.orVRegister(vx, vy)
+		c.resetVFAfterLogic()
 	case AND_V_REGISTER:
 		//Set Vx = Vx AND Vy
 		c.registers.andVRegister(vx, vy)
+		c.resetVFAfterLogic()
 	case XOR_V_REGISTER:
 		//Set Vx = Vx XOR Vy
 		c.registers.xorVRegister(vx, vy)
+		c.resetVFAfterLogic()
 	case SUM_V_REGISTER:
 		//Set Vx = Vx + Vy, set VF = carry
-		sum := c.registers.sumVRegister(vx, vy)
-		c.registers.setVRegister(vx, sum&0xFF)
-		if sum > 255 {
+		carry := uint16(c.registers.getVRegisterVal(vx))+uint16(c.registers.getVRegisterVal(vy)) > 0xFF
+		c.registers.setVRegister(vx, c.registers.sumVRegister(vx, vy))
+		if carry {
 			c.registers.setVRegister(VF, 1)
 			return
 		}
 		c.registers.clearVRegister(VF)
 	case DECREMENT_VX:
 		//Set Vx = Vx - Vy, set VF = NOT borrow
+		noBorrow := !c.registers.isGreaterThan(vy, vx)
 		c.registers.decrementVRegister(vx, c.registers.getVRegisterVal(vy))
-		if c.registers.isGreaterThan(vx, vy) {
+		if noBorrow {
 			c.registers.setVRegister(VF, 1)
 			return
 		}
 		c.registers.clearVRegister(VF)
 	case SHIFT_RIGHT:
 		//Set Vx = Vx SHR 1
+		if c.quirks.ShiftUsesVy {
+			c.registers.copyVRegister(vx, vy)
+		}
+		//VF is set last so it holds the flag when x is F
 		maskedVxRegisterValue := c.registers.getVRegisterVal(vx) & 0x1
-		c.registers.setVRegister(VF, maskedVxRegisterValue)
 		c.registers.shiftRightVRegister(vx)
+		c.registers.setVRegister(VF, maskedVxRegisterValue)
 	case DIFF_V_REGISTER:
 		//Set Vx = Vy - Vx, set VF = NOT borrow
+		noBorrow := !c.registers.isGreaterThan(vx, vy)
 		diff := c.registers.diffVRegister(vy, vx)
 		c.registers.setVRegister(vx, diff)
-		if c.registers.isGreaterThan(vy, vx) {
+		if noBorrow {
 			c.registers.setVRegister(VF, 1)
 			return
 		}
 		c.registers.clearVRegister(VF)
 	case SHIFT_LEFT:
 		//Set Vx = Vx SHL 1
-		c.registers.setVRegister(VF, c.registers.getVRegisterVal(vx)>>7)
+		if c.quirks.ShiftUsesVy {
+			c.registers.copyVRegister(vx, vy)
+		}
+		shiftedOut := c.registers.getVRegisterVal(vx) >> 7
 		c.registers.shiftLeftVRegister(vx)
+		c.registers.setVRegister(VF, shiftedOut)
 	default:
-		c.no_op()
+		c.invalidOpcode()
 	}
 }
 
@@ -211,29 +356,44 @@ func (c *Chip8) executeInstructionTypeE(vx uint16, instruction uint8) {
 	switch instruction {
 	case SKIP_ON_KEY_PRESSED:
 		//Skip next instruction if key with the value of Vx is pressed
-		key := c.registers.getVRegisterVal(vx)
-		if c.keys[key] != 0 {
-			c.stack.incrementProgramCounter()
+		if c.isKeyDown(c.registers.getVRegisterVal(vx)) {
+			c.skipNextInstruction()
 		}
 	case SKIP_ON_KEY_RELEASED:
 		//Skip next instruction if key with the value of Vx is not pressed
-		key := c.registers.getVRegisterVal(vx)
-		if c.keys[key] == 0 {
-			c.stack.incrementProgramCounter()
+		if !c.isKeyDown(c.registers.getVRegisterVal(vx)) {
+			c.skipNextInstruction()
 		}
 	default:
-		c.no_op()
+		c.invalidOpcode()
 	}
 }
 
 // executeInstructionTypeF executes sub instruction for type F instructions
 func (c *Chip8) executeInstructionTypeF(vx uint16, instruction uint8) {
 	switch instruction {
+	case LOAD_LONG_I:
+		//Set I = the 16-bit address following the instruction
+		pc := c.stack.getProgramCounter()
+		addr := uint16(c.memory.read(pc))<<8 | uint16(c.memory.read(pc+1))
+		c.registers.setIRegister(addr)
+		c.stack.incrementProgramCounter()
+	case SELECT_PLANE:
+		//Select the planes given by x for drawing
+		c.frameBuf.setPlanes(uint8(vx))
+	case LOAD_AUDIO_PATTERN:
+		//Load the 16-byte audio pattern starting at location I
+		var pattern [16]uint8
+		for i := range pattern {
+			pattern[i] = c.memory.read(c.registers.getIRegister() + uint16(i))
+		}
+		c.registers.setAudioPattern(pattern)
 	case SET_VX_DELAY_TIMER:
 		//Set Vx = delay timer value
 		c.registers.setVRegister(vx, c.registers.getDelay())
 	case WAIT_FOR_KEY:
-		c.stack.decrementProgramCounter()
+		//Wait for a key press, store the value of the key in Vx
+		c.waitForKey(vx)
 	case SET_DELAY_TIMER_VX:
 		//Set delay timer = Vx
 		c.registers.setDelay(c.registers.getVRegisterVal(vx))
@@ -246,8 +406,12 @@ func (c *Chip8) executeInstructionTypeF(vx uint16, instruction uint8) {
 		c.registers.setIRegister(i + uint16(c.registers.getVRegisterVal(vx)))
 	case SET_I_TO_SPRITE:
 		//Set I = location of sprite for digit Vx
-		addr := FontsetStartAddr + c.registers.getVRegisterVal(vx)
-		c.registers.setIRegister(uint16(addr) * 5)
+		digit := uint16(c.registers.getVRegisterVal(vx) & 0xF)
+		c.registers.setIRegister(FontsetStartAddr + digit*5)
+	case SET_I_TO_BIG_SPRITE:
+		//Set I = location of big sprite for digit Vx
+		digit := uint16(c.registers.getVRegisterVal(vx) & 0xF)
+		c.registers.setIRegister(BigFontsetStartAddr + digit*10)
 	case SET_BCD:
 		//Store BCD representation of Vx in memory locations I, I+1, and I+2
 		val := c.registers.getVRegisterVal(vx)
@@ -257,21 +421,92 @@ func (c *Chip8) executeInstructionTypeF(vx uint16, instruction uint8) {
 		c.memory.write(iReg+1, val%10)
 		val /= 10
 		c.memory.write(iReg, val%10)
+	case SET_PITCH:
+		//Set audio pitch = Vx
+		c.registers.setPitch(c.registers.getVRegisterVal(vx))
 	case REG_DUMP:
+		//Store registers V0 through Vx in memory starting at location I
 		for i := uint16(0); i <= vx; i++ {
 			iReg := c.registers.getIRegister()
 			c.memory.write(iReg+i, c.registers.getVRegisterVal(i))
 		}
+		c.advanceIAfterLoadStore(vx)
 	case READ_REGISTERS:
+		//Read registers V0 through Vx from memory starting at location I
 		for i := uint16(0); i <= vx; i++ {
 			mem := c.memory.read(c.registers.getIRegister() + i)
 			c.registers.setVRegister(i, mem)
 		}
+		c.advanceIAfterLoadStore(vx)
+	case SAVE_RPL_FLAGS:
+		//Store registers V0 through Vx in the RPL user flags
+		for i := uint16(0); i <= vx; i++ {
+			c.rplFlags[i] = c.registers.getVRegisterVal(i)
+		}
+	case LOAD_RPL_FLAGS:
+		//Read registers V0 through Vx from the RPL user flags
+		for i := uint16(0); i <= vx; i++ {
+			c.registers.setVRegister(i, c.rplFlags[i])
+		}
 	default:
-		c.no_op()
+		c.invalidOpcode()
+	}
+}
+
+// resetVFAfterLogic clears VF after a logic op when the quirks profile asks for it
+func (c *Chip8) resetVFAfterLogic() {
+	if c.quirks.LogicResetsVF {
+		c.registers.clearVRegister(VF)
+	}
+}
+
+// advanceIAfterLoadStore moves I past the registers touched by FX55/FX65
+// when the quirks profile asks for it
+func (c *Chip8) advanceIAfterLoadStore(vx uint16) {
+	if c.quirks.LoadStoreIncrementsI {
+		c.registers.setIRegister(c.registers.getIRegister() + vx + 1)
 	}
 }
 
-func (c *Chip8) no_op() {
-	//Do nothing
+// keyWait tracks an FX0A that is blocked waiting for input
+type keyWait struct {
+	Active bool
+	// Key is the key pressed during the wait, -1 until there is one
+	Key int8
+	// Held marks the keys that were down when the wait began, they only
+	// count once they have been released and pressed again
+	Held [16]bool
+	// Stale holds the presses of the current frame made before the wait
+	// began, they don't end it
+	Stale uint16
+}
+
+// waitForKey implements FX0A. The instruction repeats until a key that
+// wasn't already held is pressed and, unless the quirks profile stores on
+// press, released again, then that key is stored in Vx
+func (c *Chip8) waitForKey(vx uint16) {
+	w := &c.keyWait
+	if !w.Active {
+		*w = keyWait{Active: true, Key: -1, Stale: c.keyPressed}
+		for k, down := range c.keys {
+			w.Held[k] = down != 0
+		}
+	}
+	fresh := c.keyPressed &^ w.Stale
+	for k, down := range c.keys {
+		// a key tapped within the current frame is already up again
+		pressed := down != 0 && !w.Held[k] || fresh&(1<<k) != 0
+		if w.Key < 0 && pressed {
+			w.Key = int8(k)
+		}
+		if down == 0 {
+			w.Held[k] = false
+		}
+	}
+	if w.Key >= 0 && (c.quirks.KeyWaitOnPress || c.keys[w.Key] == 0) {
+		c.registers.setVRegister(vx, uint8(w.Key))
+		*w = keyWait{}
+		return
+	}
+	c.stack.decrementProgramCounter()
 }
@@ -0,0 +1,639 @@
+package chip8_test
+
+import (
+	"errors"
+	"gochip8/internal/chip8"
+	"gochip8/internal/chip8/chip8test"
+	"gochip8/internal/clog"
+	"testing"
+)
+
+type (
+	regs = chip8test.Regs
+	mem  = chip8test.Mem
+)
+
+var (
+	addr   = chip8test.Addr
+	screen = chip8test.Screen
+	blank  = []chip8test.Point{}
+)
+
+// fullStack is a call stack with all chip8.StackDepth levels in use
+func fullStack() []uint16 {
+	stack := make([]uint16, chip8.StackDepth)
+	for i := range stack {
+		stack[i] = 0x300 + uint16(i)*2
+	}
+	return stack
+}
+
+func TestOpcodesType0(t *testing.T) {
+	chip8test.Run(t, []chip8test.Case{
+		{
+			Name:  "00E0 clears the display",
+			Setup: chip8test.State{Lit: screen(0, 0, "#.#")},
+			Op:    0x00E0,
+			Want:  chip8test.State{Lit: blank},
+		},
+		{
+			Name:  "00EE returns",
+			Setup: chip8test.State{Stack: []uint16{0x300, 0x400}},
+			Op:    0x00EE,
+			Want:  chip8test.State{PC: addr(0x400), Stack: []uint16{0x300}},
+		},
+		{
+			Name: "00EE with an empty stack underflows",
+			Op:   0x00EE,
+			Err:  chip8.ErrStackUnderflow,
+		},
+		{
+			Name:  "00CN scrolls down",
+			Setup: chip8test.State{Lit: screen(5, 0, "#")},
+			Op:    0x00C2,
+			Want:  chip8test.State{Lit: screen(5, 2, "#")},
+		},
+		{
+			Name:  "00DN scrolls up",
+			Setup: chip8test.State{Lit: screen(5, 3, "#")},
+			Op:    0x00D1,
+			Want:  chip8test.State{Lit: screen(5, 2, "#")},
+		},
+		{
+			Name:  "00FB scrolls right",
+			Setup: chip8test.State{Lit: screen(5, 3, "#")},
+			Op:    0x00FB,
+			Want:  chip8test.State{Lit: screen(9, 3, "#")},
+		},
+		{
+			Name:  "00FC scrolls left",
+			Setup: chip8test.State{Lit: screen(5, 3, "#")},
+			Op:    0x00FC,
+			Want:  chip8test.State{Lit: screen(1, 3, "#")},
+		},
+		{
+			Name:   "00FD exits",
+			Op:     0x00FD,
+			Halted: true,
+		},
+		{
+			Name:  "00FE switches to lores, clearing the display",
+			Hires: true,
+			Setup: chip8test.State{Lit: screen(100, 50, "#")},
+			Op:    0x00FE,
+			Want:  chip8test.State{Lit: blank},
+		},
+		{
+			Name:  "00FF switches to hires, clearing the display",
+			Setup: chip8test.State{Lit: screen(0, 0, "#")},
+			Op:    0x00FF,
+			Want:  chip8test.State{Lit: blank},
+		},
+		{
+			Name: "0NNN machine code calls are invalid",
+			Op:   0x0123,
+			Err:  chip8.ErrInvalidOpcode{PC: 0x200, Op: 0x0123},
+		},
+	})
+}
+
+func TestOpcodesFlow(t *testing.T) {
+	chip8test.Run(t, []chip8test.Case{
+		{
+			Name: "1NNN jumps",
+			Op:   0x1345,
+			Want: chip8test.State{PC: addr(0x345)},
+		},
+		{
+			Name:  "2NNN calls",
+			Setup: chip8test.State{Stack: []uint16{0x300}},
+			Op:    0x2345,
+			Want:  chip8test.State{PC: addr(0x345), Stack: []uint16{0x300, 0x202}},
+		},
+		{
+			Name:  "2NNN with a full stack overflows",
+			Setup: chip8test.State{Stack: fullStack()},
+			Op:    0x2345,
+			Err:   chip8.ErrStackOverflow,
+		},
+		{
+			Name:  "3XNN skips when equal",
+			Setup: chip8test.State{V: regs{3: 0x12}},
+			Op:    0x3312,
+			Want:  chip8test.State{PC: addr(0x204)},
+		},
+		{
+			Name:  "3XNN doesn't skip when different",
+			Setup: chip8test.State{V: regs{3: 0x12}},
+			Op:    0x3313,
+		},
+		{
+			Name:  "3XNN skips both words of F000 NNNN",
+			Setup: chip8test.State{V: regs{3: 0x12}, Memory: mem{0x202: {0xF0, 0x00, 0x12, 0x34}}},
+			Op:    0x3312,
+			Want:  chip8test.State{PC: addr(0x206)},
+		},
+		{
+			Name:  "4XNN skips when different",
+			Setup: chip8test.State{V: regs{4: 1}},
+			Op:    0x4402,
+			Want:  chip8test.State{PC: addr(0x204)},
+		},
+		{
+			Name:  "4XNN doesn't skip when equal",
+			Setup: chip8test.State{V: regs{4: 1}},
+			Op:    0x4401,
+		},
+		{
+			Name:  "5XY0 skips when equal",
+			Setup: chip8test.State{V: regs{1: 7, 2: 7}},
+			Op:    0x5120,
+			Want:  chip8test.State{PC: addr(0x204)},
+		},
+		{
+			Name:  "5XY0 doesn't skip when different",
+			Setup: chip8test.State{V: regs{1: 7, 2: 8}},
+			Op:    0x5120,
+		},
+		{
+			Name:  "9XY0 skips when different",
+			Setup: chip8test.State{V: regs{1: 1, 2: 2}},
+			Op:    0x9120,
+			Want:  chip8test.State{PC: addr(0x204)},
+		},
+		{
+			Name:  "9XY0 doesn't skip when equal",
+			Setup: chip8test.State{V: regs{1: 2, 2: 2}},
+			Op:    0x9120,
+		},
+		{
+			Name:  "BNNN jumps to NNN + V0",
+			Setup: chip8test.State{V: regs{0: 4, 3: 2}},
+			Op:    0xB310,
+			Want:  chip8test.State{PC: addr(0x314)},
+		},
+		{
+			Name:   "BXNN jumps to XNN + VX",
+			Quirks: chip8.QuirksSCHIP,
+			Setup:  chip8test.State{V: regs{0: 4, 3: 2}},
+			Op:     0xB310,
+			Want:   chip8test.State{PC: addr(0x312)},
+		},
+		{
+			Name:  "EX9E skips when the key is down",
+			Keys:  []uint8{5},
+			Setup: chip8test.State{V: regs{1: 5}},
+			Op:    0xE19E,
+			Want:  chip8test.State{PC: addr(0x204)},
+		},
+		{
+			Name:  "EX9E doesn't skip when the key is up",
+			Setup: chip8test.State{V: regs{1: 5}},
+			Op:    0xE19E,
+		},
+		{
+			Name:  "EXA1 skips when the key is up",
+			Setup: chip8test.State{V: regs{1: 5}},
+			Op:    0xE1A1,
+			Want:  chip8test.State{PC: addr(0x204)},
+		},
+		{
+			Name:  "EXA1 doesn't skip when the key is down",
+			Keys:  []uint8{5},
+			Setup: chip8test.State{V: regs{1: 5}},
+			Op:    0xE1A1,
+		},
+		{
+			Name: "EX00 is invalid",
+			Op:   0xE100,
+			Err:  chip8.ErrInvalidOpcode{PC: 0x200, Op: 0xE100},
+		},
+	})
+}
+
+func TestOpcodesRegisters(t *testing.T) {
+	chip8test.Run(t, []chip8test.Case{
+		{
+			Name: "6XNN sets VX",
+			Op:   0x6A42,
+			Want: chip8test.State{V: regs{0xA: 0x42}},
+		},
+		{
+			Name:  "7XNN adds without touching VF",
+			Setup: chip8test.State{V: regs{0xA: 0xFF}},
+			Op:    0x7A02,
+			Want:  chip8test.State{V: regs{0xA: 0x01}},
+		},
+		{
+			Name:  "8XY0 copies VY",
+			Setup: chip8test.State{V: regs{2: 5}},
+			Op:    0x8120,
+			Want:  chip8test.State{V: regs{1: 5}},
+		},
+		{
+			Name:  "8XY1 ors",
+			Setup: chip8test.State{V: regs{1: 0x0C, 2: 0x0A, 0xF: 1}},
+			Op:    0x8121,
+			Want:  chip8test.State{V: regs{1: 0x0E}},
+		},
+		{
+			Name:   "8XY1 resets VF on the VIP",
+			Quirks: chip8.QuirksCOSMACVIP,
+			Setup:  chip8test.State{V: regs{1: 0x0C, 2: 0x0A, 0xF: 1}},
+			Op:     0x8121,
+			Want:   chip8test.State{V: regs{1: 0x0E, 0xF: 0}},
+		},
+		{
+			Name:  "8XY2 ands",
+			Setup: chip8test.State{V: regs{1: 0x0C, 2: 0x0A}},
+			Op:    0x8122,
+			Want:  chip8test.State{V: regs{1: 0x08}},
+		},
+		{
+			Name:  "8XY3 xors",
+			Setup: chip8test.State{V: regs{1: 0x0C, 2: 0x0A}},
+			Op:    0x8123,
+			Want:  chip8test.State{V: regs{1: 0x06}},
+		},
+		{
+			Name:  "8XY4 adds",
+			Setup: chip8test.State{V: regs{1: 1, 2: 2, 0xF: 5}},
+			Op:    0x8124,
+			Want:  chip8test.State{V: regs{1: 3, 0xF: 0}},
+		},
+		{
+			Name:  "8XY4 sets VF on carry",
+			Setup: chip8test.State{V: regs{1: 0xFF, 2: 2}},
+			Op:    0x8124,
+			Want:  chip8test.State{V: regs{1: 1, 0xF: 1}},
+		},
+		{
+			Name:  "8XY4 with VF as VX keeps the flag",
+			Setup: chip8test.State{V: regs{2: 2, 0xF: 0xFF}},
+			Op:    0x8F24,
+			Want:  chip8test.State{V: regs{0xF: 1}},
+		},
+		{
+			Name:  "8XY5 subtracts",
+			Setup: chip8test.State{V: regs{1: 5, 2: 3}},
+			Op:    0x8125,
+			Want:  chip8test.State{V: regs{1: 2, 0xF: 1}},
+		},
+		{
+			Name:  "8XY5 clears VF on borrow",
+			Setup: chip8test.State{V: regs{1: 3, 2: 5, 0xF: 1}},
+			Op:    0x8125,
+			Want:  chip8test.State{V: regs{1: 0xFE, 0xF: 0}},
+		},
+		{
+			Name:  "8XY5 of equal values doesn't borrow",
+			Setup: chip8test.State{V: regs{1: 5, 2: 5}},
+			Op:    0x8125,
+			Want:  chip8test.State{V: regs{1: 0, 0xF: 1}},
+		},
+		{
+			Name:  "8XY5 with VF as VX keeps the flag",
+			Setup: chip8test.State{V: regs{1: 3, 0xF: 5}},
+			Op:    0x8F15,
+			Want:  chip8test.State{V: regs{0xF: 1}},
+		},
+		{
+			Name:  "8XY6 shifts VX right",
+			Setup: chip8test.State{V: regs{1: 0x05, 2: 0x40}},
+			Op:    0x8126,
+			Want:  chip8test.State{V: regs{1: 0x02, 0xF: 1}},
+		},
+		{
+			Name:   "8XY6 shifts VY on the VIP",
+			Quirks: chip8.QuirksCOSMACVIP,
+			Setup:  chip8test.State{V: regs{1: 0x05, 2: 0x40}},
+			Op:     0x8126,
+			Want:   chip8test.State{V: regs{1: 0x20, 0xF: 0}},
+		},
+		{
+			Name:  "8XY6 with VF as VX keeps the flag",
+			Setup: chip8test.State{V: regs{0xF: 0x03}},
+			Op:    0x8F06,
+			Want:  chip8test.State{V: regs{0xF: 1}},
+		},
+		{
+			Name:  "8XY7 subtracts VX from VY",
+			Setup: chip8test.State{V: regs{1: 3, 2: 5}},
+			Op:    0x8127,
+			Want:  chip8test.State{V: regs{1: 2, 0xF: 1}},
+		},
+		{
+			Name:  "8XY7 clears VF on borrow",
+			Setup: chip8test.State{V: regs{1: 5, 2: 3, 0xF: 1}},
+			Op:    0x8127,
+			Want:  chip8test.State{V: regs{1: 0xFE, 0xF: 0}},
+		},
+		{
+			Name:  "8XY7 from zero doesn't borrow",
+			Setup: chip8test.State{V: regs{1: 0, 2: 10}},
+			Op:    0x8127,
+			Want:  chip8test.State{V: regs{1: 10, 0xF: 1}},
+		},
+		{
+			Name:  "8XYE shifts VX left",
+			Setup: chip8test.State{V: regs{1: 0x81, 2: 0x01}},
+			Op:    0x812E,
+			Want:  chip8test.State{V: regs{1: 0x02, 0xF: 1}},
+		},
+		{
+			Name:   "8XYE shifts VY on the VIP",
+			Quirks: chip8.QuirksCOSMACVIP,
+			Setup:  chip8test.State{V: regs{1: 0x81, 2: 0x01}},
+			Op:     0x812E,
+			Want:   chip8test.State{V: regs{1: 0x02, 0xF: 0}},
+		},
+		{
+			Name:  "8XYE with VF as VX keeps the flag",
+			Setup: chip8test.State{V: regs{0xF: 0x81}},
+			Op:    0x8F0E,
+			Want:  chip8test.State{V: regs{0xF: 1}},
+		},
+		{
+			Name: "8XYF is invalid",
+			Op:   0x8F1F,
+			Err:  chip8.ErrInvalidOpcode{PC: 0x200, Op: 0x8F1F},
+		},
+		{
+			Name: "ANNN sets I",
+			Op:   0xA123,
+			Want: chip8test.State{I: addr(0x123)},
+		},
+		{
+			Name:   "CXNN masks the random byte",
+			Random: 0xAB,
+			Op:     0xC10F,
+			Want:   chip8test.State{V: regs{1: 0x0B}},
+		},
+	})
+}
+
+func TestOpcodesDraw(t *testing.T) {
+	sprite := mem{0x300: {0xC0, 0x80}}
+	wide := mem{0x300: {0xF0, 0xF0}}
+	chip8test.Run(t, []chip8test.Case{
+		{
+			Name:  "DXYN draws",
+			Setup: chip8test.State{V: regs{0: 2, 1: 3, 0xF: 1}, I: addr(0x300), Memory: sprite},
+			Op:    0xD012,
+			Want: chip8test.State{V: regs{0xF: 0}, Lit: screen(2, 3,
+				"##",
+				"#.",
+			)},
+		},
+		{
+			Name:  "DXYN sets VF on collision",
+			Setup: chip8test.State{V: regs{0: 2, 1: 3}, I: addr(0x300), Memory: sprite, Lit: screen(2, 3, "#")},
+			Op:    0xD012,
+			Want: chip8test.State{V: regs{0xF: 1}, Lit: screen(2, 3,
+				".#",
+				"#.",
+			)},
+		},
+		{
+			Name:   "DXYN wraps the start position",
+			Quirks: chip8.QuirksCOSMACVIP,
+			Setup:  chip8test.State{V: regs{0: 66, 1: 35}, I: addr(0x300), Memory: sprite},
+			Op:     0xD012,
+			Want: chip8test.State{Lit: screen(2, 3,
+				"##",
+				"#.",
+			)},
+		},
+		{
+			Name:   "DXYN clips at the screen edge",
+			Quirks: chip8.QuirksCOSMACVIP,
+			Setup:  chip8test.State{V: regs{0: 62, 1: 31}, I: addr(0x300), Memory: wide},
+			Op:     0xD012,
+			Want:   chip8test.State{Lit: screen(62, 31, "##")},
+		},
+		{
+			Name:  "DXYN wraps at the screen edge",
+			Setup: chip8test.State{V: regs{0: 62, 1: 31}, I: addr(0x300), Memory: wide},
+			Op:    0xD012,
+			Want: chip8test.State{Lit: append(append(append(
+				screen(62, 31, "##"),
+				screen(0, 31, "##")...),
+				screen(62, 0, "##")...),
+				screen(0, 0, "##")...)},
+		},
+		{
+			Name:  "D0 draws a 16x16 sprite",
+			Hires: true,
+			Setup: chip8test.State{V: regs{0: 8, 1: 4}, I: addr(0x300), Memory: mem{0x300: {0xFF, 0xFF}, 0x31E: {0x80, 0x01}}},
+			Op:    0xD010,
+			Want: chip8test.State{Lit: append(
+				screen(8, 4, "################"),
+				screen(8, 19, "#..............#")...,
+			)},
+		},
+	})
+}
+
+func TestOpcodesTypeF(t *testing.T) {
+	chip8test.Run(t, []chip8test.Case{
+		{
+			Name:  "F000 NNNN loads a long address",
+			Setup: chip8test.State{Memory: mem{0x202: {0x12, 0x34}}},
+			Op:    0xF000,
+			Want:  chip8test.State{I: addr(0x1234), PC: addr(0x204)},
+		},
+		{
+			Name: "FN01 leaves the registers alone",
+			Op:   0xF201,
+		},
+		{
+			Name:  "F002 leaves the registers alone",
+			Setup: chip8test.State{I: addr(0x300)},
+			Op:    0xF002,
+		},
+		{
+			Name:  "FX07 reads the delay timer",
+			Setup: chip8test.State{Delay: chip8test.Byte(7)},
+			Op:    0xF107,
+			Want:  chip8test.State{V: regs{1: 7}},
+		},
+		{
+			Name:          "FX0A waits for a key",
+			Op:            0xF10A,
+			Want:          chip8test.State{PC: addr(0x200)},
+			WaitingForKey: true,
+		},
+		{
+			Name:          "FX0A ignores a key held before the wait",
+			Quirks:        chip8.QuirksSCHIP,
+			Keys:          []uint8{5},
+			Op:            0xF10A,
+			Want:          chip8test.State{PC: addr(0x200)},
+			WaitingForKey: true,
+		},
+		{
+			Name:          "FX0A waits for the key to be released on the VIP",
+			Quirks:        chip8.QuirksCOSMACVIP,
+			Keys:          []uint8{5},
+			Op:            0xF10A,
+			Want:          chip8test.State{PC: addr(0x200)},
+			WaitingForKey: true,
+		},
+		{
+			Name:  "FX15 sets the delay timer",
+			Setup: chip8test.State{V: regs{1: 9}},
+			Op:    0xF115,
+			Want:  chip8test.State{Delay: chip8test.Byte(9)},
+		},
+		{
+			Name:  "FX18 sets the sound timer",
+			Setup: chip8test.State{V: regs{1: 9}},
+			Op:    0xF118,
+			Want:  chip8test.State{Sound: chip8test.Byte(9)},
+		},
+		{
+			Name:  "FX1E adds VX to I",
+			Setup: chip8test.State{V: regs{1: 0x10}, I: addr(0x300)},
+			Op:    0xF11E,
+			Want:  chip8test.State{I: addr(0x310)},
+		},
+		{
+			Name:  "FX29 points I at a font digit",
+			Setup: chip8test.State{V: regs{1: 0x0A}},
+			Op:    0xF129,
+			Want:  chip8test.State{I: addr(chip8.FontsetStartAddr + 0xA*5)},
+		},
+		{
+			Name:  "FX29 uses the low nibble of VX",
+			Setup: chip8test.State{V: regs{1: 0x1A}},
+			Op:    0xF129,
+			Want:  chip8test.State{I: addr(chip8.FontsetStartAddr + 0xA*5)},
+		},
+		{
+			Name:  "FX30 points I at a big font digit",
+			Setup: chip8test.State{V: regs{1: 3}},
+			Op:    0xF130,
+			Want:  chip8test.State{I: addr(chip8.BigFontsetStartAddr + 3*10)},
+		},
+		{
+			Name:  "FX33 stores BCD",
+			Setup: chip8test.State{V: regs{1: 234}, I: addr(0x300)},
+			Op:    0xF133,
+			Want:  chip8test.State{Memory: mem{0x300: {2, 3, 4}}},
+		},
+		{
+			Name:  "FX3A leaves the registers alone",
+			Setup: chip8test.State{V: regs{1: 100}},
+			Op:    0xF13A,
+		},
+		{
+			Name:  "FX55 stores registers",
+			Setup: chip8test.State{V: regs{0: 1, 1: 2, 2: 3, 3: 4}, I: addr(0x300)},
+			Op:    0xF255,
+			Want:  chip8test.State{Memory: mem{0x300: {1, 2, 3, 0}}},
+		},
+		{
+			Name:   "FX55 advances I on the VIP",
+			Quirks: chip8.QuirksCOSMACVIP,
+			Setup:  chip8test.State{V: regs{0: 1, 1: 2, 2: 3}, I: addr(0x300)},
+			Op:     0xF255,
+			Want:   chip8test.State{I: addr(0x303), Memory: mem{0x300: {1, 2, 3}}},
+		},
+		{
+			Name:  "FX65 loads registers",
+			Setup: chip8test.State{I: addr(0x300), Memory: mem{0x300: {1, 2, 3, 4}}},
+			Op:    0xF265,
+			Want:  chip8test.State{V: regs{0: 1, 1: 2, 2: 3}},
+		},
+		{
+			Name:   "FX65 advances I on the VIP",
+			Quirks: chip8.QuirksCOSMACVIP,
+			Setup:  chip8test.State{I: addr(0x300), Memory: mem{0x300: {1, 2, 3}}},
+			Op:     0xF265,
+			Want:   chip8test.State{V: regs{0: 1, 1: 2, 2: 3}, I: addr(0x303)},
+		},
+		{
+			Name:   "FX65 past 4K is out of bounds on the VIP",
+			Quirks: chip8.QuirksCOSMACVIP,
+			Setup:  chip8test.State{I: addr(0xFFF), Memory: mem{0xFFF: {7}}},
+			Op:     0xF165,
+			Want:   chip8test.State{V: regs{0: 7}, I: addr(0x1001)},
+			Err:    chip8.ErrMemoryOutOfBounds,
+		},
+		{
+			Name:   "FX65 past 4K is in bounds on XO-CHIP",
+			Quirks: chip8.QuirksXOCHIP,
+			Setup:  chip8test.State{I: addr(0xFFF), Memory: mem{0xFFF: {7, 8}}},
+			Op:     0xF165,
+			Want:   chip8test.State{V: regs{0: 7, 1: 8}, I: addr(0x1001)},
+		},
+		{
+			Name:  "FX75 leaves the registers alone",
+			Setup: chip8test.State{V: regs{0: 1, 1: 2}},
+			Op:    0xF175,
+		},
+		{
+			Name:  "FX85 loads the RPL flags",
+			Setup: chip8test.State{V: regs{0: 1, 1: 2, 2: 3}},
+			Op:    0xF185,
+			Want:  chip8test.State{V: regs{0: 0, 1: 0}},
+		},
+		{
+			Name: "FX99 is invalid",
+			Op:   0xF199,
+			Err:  chip8.ErrInvalidOpcode{PC: 0x200, Op: 0xF199},
+		},
+	})
+}
+
+func TestOpcodesType5(t *testing.T) {
+	chip8test.Run(t, []chip8test.Case{
+		{
+			Name:  "5XY2 stores a register range",
+			Setup: chip8test.State{V: regs{1: 1, 2: 2, 3: 3}, I: addr(0x300)},
+			Op:    0x5132,
+			Want:  chip8test.State{Memory: mem{0x300: {1, 2, 3}}},
+		},
+		{
+			Name:  "5XY2 stores a reversed range",
+			Setup: chip8test.State{V: regs{1: 1, 2: 2, 3: 3}, I: addr(0x300)},
+			Op:    0x5312,
+			Want:  chip8test.State{Memory: mem{0x300: {3, 2, 1}}},
+		},
+		{
+			Name:  "5XY3 loads a register range",
+			Setup: chip8test.State{I: addr(0x300), Memory: mem{0x300: {9, 8}}},
+			Op:    0x5123,
+			Want:  chip8test.State{V: regs{1: 9, 2: 8}},
+		},
+		{
+			Name: "5XY1 is invalid",
+			Op:   0x5121,
+			Err:  chip8.ErrInvalidOpcode{PC: 0x200, Op: 0x5121},
+		},
+	})
+}
+
+// TestStackDepth nests calls until the stack is full, the next call must
+// overflow without touching the stack
+func TestStackDepth(t *testing.T) {
+	c := chip8.Init(chip8.QuirksCOSMACVIP)
+	c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+	c.SetErrorPolicy(chip8.Strict)
+	//2200 calls itself
+	c.Load([]byte{0x22, 0x00})
+	for depth := 1; depth <= chip8.StackDepth; depth++ {
+		if err := c.Cycle(); err != nil {
+			t.Fatalf("call %d: %v", depth, err)
+		}
+		if sp := c.GetRegisterState().SP; sp != uint16(depth) {
+			t.Fatalf("call %d left the stack pointer at %d", depth, sp)
+		}
+	}
+	if err := c.Cycle(); !errors.Is(err, chip8.ErrStackOverflow) {
+		t.Fatalf("call %d returned %v, want %v", chip8.StackDepth+1, err, chip8.ErrStackOverflow)
+	}
+	if sp := c.GetRegisterState().SP; sp != uint16(chip8.StackDepth) {
+		t.Errorf("overflowing call moved the stack pointer to %d", sp)
+	}
+}
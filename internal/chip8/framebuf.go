@@ -1,23 +1,127 @@
 package chip8
 
-// getFrameBuffer returns the frame buffer
-func (fb *FrameBuf) getFrameBuffer() [2048]uint32 {
+// getFrameBuffer returns the frame buffer for the active resolution
+func (fb *FrameBuf) getFrameBuffer() []uint32 {
 	return fb.buf
 }
 
-// clear clears the frame buffer
+// getWidth returns the width of the active resolution
+func (fb *FrameBuf) getWidth() uint16 {
+	return fb.width
+}
+
+// getHeight returns the height of the active resolution
+func (fb *FrameBuf) getHeight() uint16 {
+	return fb.height
+}
+
+// setResolution switches between the 64x32 and 128x64 modes, clearing the display
+func (fb *FrameBuf) setResolution(hiRes bool) {
+	fb.width, fb.height = VideoBufferWidth, VideoBufferHeight
+	if hiRes {
+		fb.width, fb.height = HiResVideoBufferWidth, HiResVideoBufferHeight
+	}
+	fb.buf = make([]uint32, int(fb.width)*int(fb.height))
+}
+
+// getPlanes returns the bitmask of planes selected for drawing
+func (fb *FrameBuf) getPlanes() uint8 {
+	return fb.planes
+}
+
+// setPlanes selects the planes that drawing, clearing and scrolling affect
+func (fb *FrameBuf) setPlanes(planes uint8) {
+	fb.planes = planes & PlaneMask
+}
+
+// clear clears the selected planes of the frame buffer
 func (fb *FrameBuf) clear() {
-	fb.buf = [2048]uint32{}
+	keep := ^uint32(fb.planes)
+	for i := range fb.buf {
+		fb.buf[i] &= keep
+	}
 }
 
-// setPixel sets the pixel at the given display index
-func (fb *FrameBuf) setPixel(displayIndex uint16) {
-	fb.buf[displayIndex] ^= 0xFFFFFFFF
+// getPixel returns the planes lit at the given display index
+func (fb *FrameBuf) getPixel(displayIndex uint16) uint32 {
+	return fb.buf[displayIndex]
 }
 
-// initFrameBuf initializes the frame buffer
-func InitFrameBuf() *FrameBuf {
-	return &FrameBuf{
-		buf: [2048]uint32{},
+// flipPixel toggles the given planes at the display index
+func (fb *FrameBuf) flipPixel(displayIndex uint16, planes uint8) {
+	fb.buf[displayIndex] ^= uint32(planes)
+}
+
+// moveSelected copies the selected planes of pixel src into pixel dst
+func (fb *FrameBuf) moveSelected(dst, src int) {
+	mask := uint32(fb.planes)
+	fb.buf[dst] = fb.buf[dst]&^mask | fb.buf[src]&mask
+}
+
+// blankSelected clears the selected planes of pixel i
+func (fb *FrameBuf) blankSelected(i int) {
+	fb.buf[i] &^= uint32(fb.planes)
+}
+
+// scrollDown moves the selected planes down n rows, filling the top with blank rows
+func (fb *FrameBuf) scrollDown(n uint16) {
+	w, h := int(fb.width), int(fb.height)
+	for y := h - 1; y >= 0; y-- {
+		for x := 0; x < w; x++ {
+			if y >= int(n) {
+				fb.moveSelected(y*w+x, (y-int(n))*w+x)
+				continue
+			}
+			fb.blankSelected(y*w + x)
+		}
+	}
+}
+
+// scrollUp moves the selected planes up n rows, filling the bottom with blank rows
+func (fb *FrameBuf) scrollUp(n uint16) {
+	w, h := int(fb.width), int(fb.height)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if y+int(n) < h {
+				fb.moveSelected(y*w+x, (y+int(n))*w+x)
+				continue
+			}
+			fb.blankSelected(y*w + x)
+		}
 	}
 }
+
+// scrollRight moves the selected planes right n columns, filling the left with blank columns
+func (fb *FrameBuf) scrollRight(n uint16) {
+	w, h := int(fb.width), int(fb.height)
+	for y := 0; y < h; y++ {
+		for x := w - 1; x >= 0; x-- {
+			if x >= int(n) {
+				fb.moveSelected(y*w+x, y*w+x-int(n))
+				continue
+			}
+			fb.blankSelected(y*w + x)
+		}
+	}
+}
+
+// scrollLeft moves the selected planes left n columns, filling the right with blank columns
+func (fb *FrameBuf) scrollLeft(n uint16) {
+	w, h := int(fb.width), int(fb.height)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x+int(n) < w {
+				fb.moveSelected(y*w+x, y*w+x+int(n))
+				continue
+			}
+			fb.blankSelected(y*w + x)
+		}
+	}
+}
+
+// initFrameBuf initializes the frame buffer in the 64x32 mode with the first plane selected
+func InitFrameBuf() *FrameBuf {
+	fb := &FrameBuf{planes: 1}
+	fb.setResolution(false)
+	return fb
+}
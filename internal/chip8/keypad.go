@@ -0,0 +1,72 @@
+package chip8
+
+// isKeyDown reports whether key is held, or was tapped during the current
+// frame, as seen by EX9E/EXA1
+func (c *Chip8) isKeyDown(key uint8) bool {
+	key &= 0xF
+	return c.keys[key] != 0 || c.keyPressed&(1<<key) != 0
+}
+
+// clearKeyEdges forgets the key transitions at the end of a frame
+func (c *Chip8) clearKeyEdges() {
+	c.keyPressed = 0
+	c.keyReleased = 0
+	c.keyWait.Stale = 0
+}
+
+// public method for external pkg to press a key on the hex keypad
+func (c *Chip8) KeyDown(key uint8) {
+	key &= 0xF
+	if c.keys[key] == 0 {
+		c.keyPressed |= 1 << key
+	}
+	c.keys[key] = 1
+}
+
+// public method for external pkg to release a key on the hex keypad
+func (c *Chip8) KeyUp(key uint8) {
+	key &= 0xF
+	if c.keys[key] != 0 {
+		c.keyReleased |= 1 << key
+	}
+	c.keys[key] = 0
+	//a key released during FX0A counts when it is pressed again, even
+	//within the same frame
+	if c.keyWait.Active {
+		c.keyWait.Held[key] = false
+		c.keyWait.Stale &^= 1 << key
+	}
+}
+
+// public method for external pkg to set the whole keypad at once, keys that
+// changed produce the same transitions as KeyDown and KeyUp
+func (c *Chip8) SetKeys(keys [16]bool) {
+	for k, down := range keys {
+		if down {
+			c.KeyDown(uint8(k))
+		} else {
+			c.KeyUp(uint8(k))
+		}
+	}
+}
+
+// public method for external pkg to get which keys are held
+func (c *Chip8) Keys() [16]bool {
+	var keys [16]bool
+	for k, down := range c.keys {
+		keys[k] = down != 0
+	}
+	return keys
+}
+
+// public method for external pkg to check whether key went down during the
+// current frame
+func (c *Chip8) JustPressed(key uint8) bool {
+	return c.keyPressed&(1<<(key&0xF)) != 0
+}
+
+// public method for external pkg to check whether key went up during the
+// current frame
+func (c *Chip8) JustReleased(key uint8) bool {
+	return c.keyReleased&(1<<(key&0xF)) != 0
+}
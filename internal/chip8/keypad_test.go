@@ -0,0 +1,82 @@
+package chip8_test
+
+import (
+	"gochip8/internal/chip8"
+	"gochip8/internal/clog"
+	"testing"
+)
+
+// newKeyWait returns a silent chip8 blocked in F30A
+func newKeyWait(t *testing.T, quirks chip8.Quirks) *chip8.Chip8 {
+	t.Helper()
+	c := chip8.Init(quirks)
+	c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+	c.Load([]byte{0xF3, 0x0A})
+	return c
+}
+
+// waitStep executes F30A and reports whether the wait is still blocked
+func waitStep(t *testing.T, c *chip8.Chip8) bool {
+	t.Helper()
+	if err := c.ExecuteOpcode(0xF30A); err != nil {
+		t.Fatal(err)
+	}
+	return c.GetRegisterState().WaitingForKey
+}
+
+func TestKeyWaitIgnoresKeyHeldBeforeWait(t *testing.T) {
+	c := newKeyWait(t, chip8.QuirksCOSMACVIP)
+	c.KeyDown(5)
+	if !waitStep(t, c) {
+		t.Fatal("a key held before FX0A ended the wait")
+	}
+	c.TickTimers()
+	c.KeyUp(5)
+	if !waitStep(t, c) {
+		t.Fatalf("releasing a key held before FX0A ended the wait with V3=%d", c.GetRegisterState().V[3])
+	}
+}
+
+func TestKeyWaitStoresFreshPress(t *testing.T) {
+	c := newKeyWait(t, chip8.QuirksSCHIP)
+	c.KeyDown(5)
+	waitStep(t, c)
+	c.KeyUp(5)
+	c.KeyDown(5)
+	if waitStep(t, c) {
+		t.Fatal("pressing a key again didn't end the wait")
+	}
+	if v := c.GetRegisterState().V[3]; v != 5 {
+		t.Errorf("V3 = %d, want 5", v)
+	}
+}
+
+func TestKeyWaitStoresTapWithinFrame(t *testing.T) {
+	c := newKeyWait(t, chip8.QuirksCOSMACVIP)
+	waitStep(t, c)
+	c.KeyDown(7)
+	c.KeyUp(7)
+	if waitStep(t, c) {
+		t.Fatal("a key tapped during the wait didn't end it")
+	}
+	if v := c.GetRegisterState().V[3]; v != 7 {
+		t.Errorf("V3 = %d, want 7", v)
+	}
+}
+
+func TestKeyWaitPausingTimersClearsKeyEdges(t *testing.T) {
+	quirks := chip8.QuirksCOSMACVIP
+	quirks.KeyWaitPausesTimers = true
+	c := newKeyWait(t, quirks)
+	c.KeyDown(5)
+	waitStep(t, c)
+	c.TickTimers()
+	if c.JustPressed(5) {
+		t.Error("JustPressed is still set after a frame with paused timers")
+	}
+	c.KeyUp(5)
+	c.TickTimers()
+	if c.JustReleased(5) {
+		t.Error("JustReleased is still set after a frame with paused timers")
+	}
+}
@@ -8,27 +8,41 @@ func (m *Memory) loadROM(raw []byte) {
 	}
 }
 
-// loadFontset loads the fontset into memory starting at 0x50
+// loadFontset loads the fontset into memory starting at 0x50,
+// followed by the SUPER-CHIP big fontset at 0xA0
 func (m *Memory) loadFontset() {
 	for i, b := range fontset {
 		m.buf[FontsetStartAddr+i] = b
 	}
+	for i, b := range bigFontset {
+		m.buf[BigFontsetStartAddr+i] = b
+	}
 }
 
 // write writes a byte to the memory buffer at the given address
 func (m *Memory) write(address uint16, value uint8) {
+	m.checkBounds(address)
 	m.buf[address] = value
 }
 
 // read reads a byte from the memory buffer at the given address
 func (m *Memory) read(address uint16) uint8 {
+	m.checkBounds(address)
 	return m.buf[address]
 }
 
+// checkBounds flags accesses past the address space of the quirks profile
+func (m *Memory) checkBounds(address uint16) {
+	if uint32(address) >= m.size {
+		m.outOfBounds = true
+	}
+}
+
 // InitMemory initializes the memory buffer and loads the fontset
 func InitMemory() *Memory {
 	mem := &Memory{
-		buf: [MemoryBufferSize]uint8{},
+		buf:  [MemoryBufferSize]uint8{},
+		size: MemoryBufferSize,
 	}
 	mem.loadFontset()
 	return mem
@@ -0,0 +1,29 @@
+package chip8_test
+
+import (
+	"bytes"
+	"errors"
+	"gochip8/internal/chip8"
+	"testing"
+)
+
+func TestLoadROMSize(t *testing.T) {
+	space := chip8.MemoryBufferSize - chip8.StartAddr
+	c := chip8.Init(chip8.QuirksXOCHIP)
+	full := bytes.Repeat([]byte{0xAB}, space)
+	if err := c.Load(full); err != nil {
+		t.Fatalf("loading a ROM filling memory returned %v", err)
+	}
+	if last := c.ReadMemory(chip8.MemoryBufferSize - 1); last != 0xAB {
+		t.Errorf("last byte of memory is 0x%02X, want 0xAB", last)
+	}
+
+	c = chip8.Init(chip8.QuirksXOCHIP)
+	hash := c.ROMHash()
+	if err := c.Load(bytes.Repeat([]byte{0xAB}, space+1)); !errors.Is(err, chip8.ErrROMTooLarge) {
+		t.Fatalf("loading an oversize ROM returned %v, want %v", err, chip8.ErrROMTooLarge)
+	}
+	if c.ReadMemory(chip8.StartAddr) != 0 || c.ROMHash() != hash {
+		t.Error("an oversize ROM was partly loaded")
+	}
+}
@@ -0,0 +1,95 @@
+package chip8
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Quirks selects between the interpretations of the ambiguous opcodes
+// that different chip8 implementations settled on
+type Quirks struct {
+	// ShiftUsesVy makes 8XY6/8XYE shift Vy into Vx instead of shifting Vx in place
+	ShiftUsesVy bool
+	// LoadStoreIncrementsI makes FX55/FX65 leave I pointing past the last register
+	LoadStoreIncrementsI bool
+	// JumpUsesVx makes BNNN behave as BXNN, jumping to XNN + Vx
+	JumpUsesVx bool
+	// LogicResetsVF makes 8XY1/8XY2/8XY3 clear VF
+	LogicResetsVF bool
+	// ClipSprites clips sprites at the screen edge instead of wrapping them
+	ClipSprites bool
+	// KeyWaitOnPress makes FX0A store the key as soon as it is pressed, the
+	// COSMAC VIP waits for it to be released
+	KeyWaitOnPress bool
+	// KeyWaitPausesTimers stops the delay and sound timers while FX0A waits
+	KeyWaitPausesTimers bool
+	// LargeMemory gives programs the 64K address space of XO-CHIP, the
+	// other interpreters address 4K
+	LargeMemory bool
+}
+
+// QuirksCOSMACVIP matches the original interpreter on the COSMAC VIP
+var QuirksCOSMACVIP = Quirks{
+	ShiftUsesVy:          true,
+	LoadStoreIncrementsI: true,
+	LogicResetsVF:        true,
+	ClipSprites:          true,
+}
+
+// QuirksCHIP48 matches CHIP-48 on the HP-48 calculators
+var QuirksCHIP48 = Quirks{
+	LoadStoreIncrementsI: true,
+	JumpUsesVx:           true,
+	ClipSprites:          true,
+	KeyWaitOnPress:       true,
+}
+
+// QuirksSCHIP matches SUPER-CHIP 1.1
+var QuirksSCHIP = Quirks{
+	JumpUsesVx:     true,
+	ClipSprites:    true,
+	KeyWaitOnPress: true,
+}
+
+// QuirksXOCHIP matches Octo's XO-CHIP
+var QuirksXOCHIP = Quirks{
+	ShiftUsesVy:          true,
+	LoadStoreIncrementsI: true,
+	LargeMemory:          true,
+}
+
+// addressSpace returns the number of bytes of memory programs may address
+func (q Quirks) addressSpace() uint32 {
+	if q.LargeMemory {
+		return MemoryBufferSize
+	}
+	return SmallMemorySize
+}
+
+// quirksProfiles maps the profile names accepted on the command line to their quirks
+var quirksProfiles = map[string]Quirks{
+	"vip":    QuirksCOSMACVIP,
+	"chip48": QuirksCHIP48,
+	"schip":  QuirksSCHIP,
+	"xochip": QuirksXOCHIP,
+}
+
+// QuirksProfileNames returns the names of the built-in quirks profiles
+func QuirksProfileNames() []string {
+	names := make([]string, 0, len(quirksProfiles))
+	for name := range quirksProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// QuirksProfile looks up a built-in quirks profile by name
+func QuirksProfile(name string) (Quirks, error) {
+	q, ok := quirksProfiles[strings.ToLower(name)]
+	if !ok {
+		return Quirks{}, fmt.Errorf("unknown quirks profile %q, expected one of %s", name, strings.Join(QuirksProfileNames(), ", "))
+	}
+	return q, nil
+}
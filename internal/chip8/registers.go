@@ -96,8 +96,25 @@ func (r *Registers) decrementSound() {
 	}
 }
 
+func (r *Registers) setAudioPattern(pattern [16]uint8) {
+	r.audioPattern = pattern
+}
+
+func (r *Registers) getAudioPattern() [16]uint8 {
+	return r.audioPattern
+}
+
+func (r *Registers) setPitch(value uint8) {
+	r.pitch = value
+}
+
+func (r *Registers) getPitch() uint8 {
+	return r.pitch
+}
+
 func InitRegisters() *Registers {
 	return &Registers{
 		vRegister: [16]uint8{},
+		pitch:     DefaultPitch,
 	}
 }
@@ -0,0 +1,133 @@
+package chip8
+
+const maxPixels = HiResVideoBufferWidth * HiResVideoBufferHeight
+
+// deltaRun is a span of bytes that changed between two frames, stored as
+// the xor of the old and new values so the same run undoes the change
+type deltaRun struct {
+	offset int
+	xor    []uint8
+}
+
+// rewindFrame holds what is needed to step back to an earlier frame: its
+// cpu state in full and the memory and pixel changes made after it
+type rewindFrame struct {
+	cpu         cpuState
+	memoryDelta []deltaRun
+	pixelDelta  []deltaRun
+}
+
+// Rewind is a ring buffer of compact per-frame snapshots. Only the latest
+// frame is kept in full, earlier frames are recovered by undoing the xor
+// deltas of memory and the framebuffer one frame at a time
+type Rewind struct {
+	frames  []rewindFrame
+	head    int
+	count   int
+	current *machineState
+	pixels  [maxPixels]uint8
+	scratch *machineState
+	spare   [maxPixels]uint8
+}
+
+// NewRewind creates a rewind buffer holding up to capacity frames
+func NewRewind(capacity int) *Rewind {
+	return &Rewind{
+		frames: make([]rewindFrame, capacity),
+	}
+}
+
+// Len returns the number of frames that can be stepped back
+func (r *Rewind) Len() int {
+	return r.count
+}
+
+// Reset drops every recorded frame, used after the machine state was
+// replaced by other means such as loading a save state
+func (r *Rewind) Reset() {
+	r.count = 0
+	r.current = nil
+}
+
+// capture copies the chip8 memory and pixels into s and pixels
+func (r *Rewind) capture(c *Chip8, s *machineState, pixels *[maxPixels]uint8) {
+	s.cpuState = c.captureCPUState()
+	s.Memory = c.memory.buf
+	*pixels = [maxPixels]uint8{}
+	for i, p := range c.frameBuf.getFrameBuffer() {
+		pixels[i] = uint8(p)
+	}
+}
+
+// Push records the current frame of the chip8, evicting the oldest frame
+// once the buffer is full
+func (r *Rewind) Push(c *Chip8) {
+	if len(r.frames) == 0 {
+		return
+	}
+	if r.current == nil {
+		r.current = &machineState{}
+		r.scratch = &machineState{}
+		r.capture(c, r.current, &r.pixels)
+		return
+	}
+	r.capture(c, r.scratch, &r.spare)
+	frame := rewindFrame{
+		cpu:         r.current.cpuState,
+		memoryDelta: diffRuns(r.current.Memory[:], r.scratch.Memory[:]),
+		pixelDelta:  diffRuns(r.pixels[:], r.spare[:]),
+	}
+	r.frames[r.head] = frame
+	r.head = (r.head + 1) % len(r.frames)
+	if r.count < len(r.frames) {
+		r.count++
+	}
+	r.current, r.scratch = r.scratch, r.current
+	r.pixels, r.spare = r.spare, r.pixels
+}
+
+// StepBack restores the chip8 to the frame before the latest one recorded,
+// returning false once the buffer is exhausted
+func (r *Rewind) StepBack(c *Chip8) bool {
+	if r.count == 0 {
+		return false
+	}
+	r.head = (r.head - 1 + len(r.frames)) % len(r.frames)
+	r.count--
+	frame := r.frames[r.head]
+	r.frames[r.head] = rewindFrame{}
+	applyRuns(r.current.Memory[:], frame.memoryDelta)
+	applyRuns(r.pixels[:], frame.pixelDelta)
+	r.current.cpuState = frame.cpu
+	c.restoreState(r.current, r.pixels[:int(frame.cpu.Width)*int(frame.cpu.Height)])
+	return true
+}
+
+// diffRuns returns the spans where prev and next differ, xor encoded
+func diffRuns(prev, next []uint8) []deltaRun {
+	var runs []deltaRun
+	for i := 0; i < len(prev); i++ {
+		if prev[i] == next[i] {
+			continue
+		}
+		start := i
+		for i < len(prev) && prev[i] != next[i] {
+			i++
+		}
+		run := deltaRun{offset: start, xor: make([]uint8, i-start)}
+		for j := range run.xor {
+			run.xor[j] = prev[start+j] ^ next[start+j]
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// applyRuns xors the runs into buf, undoing or redoing the change they encode
+func applyRuns(buf []uint8, runs []deltaRun) {
+	for _, run := range runs {
+		for j, x := range run.xor {
+			buf[run.offset+j] ^= x
+		}
+	}
+}
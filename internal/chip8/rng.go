@@ -0,0 +1,136 @@
+package chip8
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RNG generates the random bytes used by CXNN
+type RNG interface {
+	// Seed restarts the sequence, the same seed always gives the same bytes
+	Seed(seed int64)
+	Byte() uint8
+}
+
+// StatefulRNG is a generator whose position in its sequence can be saved,
+// save states and rewind carry it so CXNN draws the same bytes after a load
+type StatefulRNG interface {
+	RNG
+	State() uint64
+	SetState(state uint64)
+}
+
+// DefaultRNG is the name of the generator a chip8 starts with
+const DefaultRNG = "default"
+
+// rngs builds the named generators for SelectRNG
+var rngs = map[string]func(c *Chip8) RNG{
+	DefaultRNG: func(c *Chip8) RNG { return NewRNG() },
+	"vip":      func(c *Chip8) RNG { return NewVIPRNG(c.memory.read) },
+}
+
+// RNGNames returns the names accepted by SelectRNG
+func RNGNames() []string {
+	names := make([]string, 0, len(rngs))
+	for name := range rngs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mathRNG draws bytes from a splitmix64 sequence, its whole state is a
+// single word so it can be saved
+type mathRNG struct {
+	state uint64
+}
+
+// NewRNG returns the default generator
+func NewRNG() RNG {
+	return &mathRNG{}
+}
+
+func (m *mathRNG) Seed(seed int64) {
+	m.state = uint64(seed)
+}
+
+func (m *mathRNG) Byte() uint8 {
+	m.state += 0x9E3779B97F4A7C15
+	z := m.state
+	z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+	z = (z ^ z>>27) * 0x94D049BB133111EB
+	return uint8((z ^ z>>31) >> 56)
+}
+
+func (m *mathRNG) State() uint64 {
+	return m.state
+}
+
+func (m *mathRNG) SetState(state uint64) {
+	m.state = state
+}
+
+// vipRNG reproduces the COSMAC VIP interpreter's generator. The VIP keeps
+// a 16 bit counter in R9 which is stepped on every call, its low byte
+// indexes the interpreter's own code page at 0x100 and the byte found
+// there is added into the high byte, which is the result. The sequence
+// therefore depends on what memory holds at 0x100-0x1FF: this emulator
+// keeps the big font there rather than the VIP interpreter, so write the
+// interpreter page into memory for bit-exact sequences
+type vipRNG struct {
+	read    func(address uint16) uint8
+	counter uint16
+}
+
+// NewVIPRNG returns the COSMAC VIP generator reading memory through read
+func NewVIPRNG(read func(address uint16) uint8) RNG {
+	return &vipRNG{read: read}
+}
+
+// Seed sets the counter, only the low 16 bits of seed are used
+func (v *vipRNG) Seed(seed int64) {
+	v.counter = uint16(seed)
+}
+
+func (v *vipRNG) Byte() uint8 {
+	v.counter++
+	lo := uint8(v.counter)
+	hi := uint8(v.counter>>8) + v.read(0x100|uint16(lo))
+	v.counter = uint16(hi)<<8 | uint16(lo)
+	return hi
+}
+
+func (v *vipRNG) State() uint64 {
+	return uint64(v.counter)
+}
+
+func (v *vipRNG) SetState(state uint64) {
+	v.counter = uint16(state)
+}
+
+// public method for external pkg to replace the random number generator,
+// it is seeded with the current seed. Save states only carry its position
+// when it implements StatefulRNG
+func (c *Chip8) SetRNG(rng RNG) {
+	c.rng = rng
+	c.rngName = ""
+	c.rng.Seed(c.seed)
+}
+
+// public method for external pkg to switch to one of the built-in random
+// number generators listed by RNGNames
+func (c *Chip8) SelectRNG(name string) error {
+	newRNG, ok := rngs[name]
+	if !ok {
+		return fmt.Errorf("unknown RNG %q", name)
+	}
+	c.SetRNG(newRNG(c))
+	c.rngName = name
+	return nil
+}
+
+// public method for external pkg to get the name of the built-in random
+// number generator in use, empty when one was set with SetRNG
+func (c *Chip8) RNGName() string {
+	return c.rngName
+}
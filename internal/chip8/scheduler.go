@@ -0,0 +1,55 @@
+package chip8
+
+import "time"
+
+const (
+	TimerFrequency     = 60
+	DefaultIPF         = 11
+	maxFramesBehind    = 5
+	timerFrameDuration = time.Second / TimerFrequency
+)
+
+// Scheduler paces a chip8 in real time, running a fixed number of
+// instructions per frame while ticking the timers at exactly 60 Hz
+type Scheduler struct {
+	chip8 *Chip8
+	ipf   int
+	next  time.Time
+}
+
+// NewScheduler creates a scheduler running ipf instructions per frame
+func NewScheduler(c *Chip8, ipf int) *Scheduler {
+	if ipf < 1 {
+		ipf = DefaultIPF
+	}
+	return &Scheduler{
+		chip8: c,
+		ipf:   ipf,
+	}
+}
+
+// RunFrame executes one frame worth of instructions and ticks the timers,
+// returning the fault that stopped a strict chip8
+func (s *Scheduler) RunFrame() error {
+	return s.chip8.RunFrame(s.ipf)
+}
+
+// Run calls frame on the 60 Hz clock until it returns false or the ROM
+// exits. frame normally calls RunFrame, then polls input and presents the
+// display. When the host falls more than a few frames behind the clock is
+// reset rather than running a burst of catch-up frames
+func (s *Scheduler) Run(frame func() bool) {
+	s.next = time.Now()
+	for !s.chip8.Halted() {
+		if !frame() {
+			return
+		}
+		s.next = s.next.Add(timerFrameDuration)
+		wait := time.Until(s.next)
+		if wait < -maxFramesBehind*timerFrameDuration {
+			s.next = time.Now()
+			continue
+		}
+		time.Sleep(wait)
+	}
+}
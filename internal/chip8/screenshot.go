@@ -0,0 +1,81 @@
+package chip8
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// maxScreenshots bounds the search for a free screenshot filename
+const maxScreenshots = 10000
+
+// GrayPalette colours the plane bitmask of a pixel in grey: background,
+// first plane, second plane, and both planes
+var GrayPalette = color.Palette{
+	color.Gray{Y: 0x00},
+	color.Gray{Y: 0xFF},
+	color.Gray{Y: 0xAA},
+	color.Gray{Y: 0x55},
+}
+
+// public method for external pkg to render the display as a paletted image,
+// each pixel scaled to a scale x scale square and coloured by indexing
+// palette with its plane bitmask. A nil palette uses GrayPalette
+func (c *Chip8) Screenshot(scale int, palette color.Palette) *image.Paletted {
+	if scale < 1 {
+		scale = 1
+	}
+	if len(palette) <= PlaneMask {
+		palette = GrayPalette
+	}
+	buf := c.frameBuf.getFrameBuffer()
+	width, height := c.GetDisplaySize()
+	img := image.NewPaletted(image.Rect(0, 0, width*scale, height*scale), palette)
+	for y := 0; y < height*scale; y++ {
+		row := buf[(y/scale)*width:]
+		for x := 0; x < width*scale; x++ {
+			img.Pix[y*img.Stride+x] = uint8(row[x/scale] & PlaneMask)
+		}
+	}
+	return img
+}
+
+// public method for external pkg to encode a screenshot as a PNG
+func (c *Chip8) WriteScreenshot(w io.Writer, scale int, palette color.Palette) error {
+	return png.Encode(w, c.Screenshot(scale, palette))
+}
+
+// public method for external pkg to save a screenshot to the first unused
+// chip8-NNNN.png in dir, returning the path written. The file is removed
+// again when the screenshot can't be written
+func (c *Chip8) SaveScreenshot(dir string, scale int, palette color.Palette) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	for n := 1; n < maxScreenshots; n++ {
+		path := filepath.Join(dir, fmt.Sprintf("chip8-%04d.png", n))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		err = c.WriteScreenshot(f, scale, palette)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			//don't leave a truncated image behind
+			os.Remove(path)
+			return "", err
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("no free screenshot filename in %s", dir)
+}
@@ -41,6 +41,32 @@ func (s *Stack) setCurStackVal(val uint16) {
 	s.stack[s.stackPointer] = val
 }
 
+// StackDepth is the number of nested subroutine calls the stack holds,
+// slot 0 of the stack stays empty so a stack pointer of 0 means no calls
+const StackDepth = len(Stack{}.stack) - 1
+
+// push saves pc on the stack for a subroutine call. It returns false and
+// leaves the stack alone when StackDepth calls are already nested
+func (s *Stack) push(pc uint16) bool {
+	if int(s.stackPointer) >= StackDepth {
+		return false
+	}
+	s.incrementStackPointer()
+	s.setCurStackVal(pc)
+	return true
+}
+
+// pop returns from a subroutine, restoring the saved pc. It returns false
+// and leaves the stack alone when it is empty
+func (s *Stack) pop() bool {
+	if s.stackPointer == 0 {
+		return false
+	}
+	s.setProgramCounter(s.getCurStackVal())
+	s.decrementStackPointer()
+	return true
+}
+
 // returns the stack pointer
 func (s *Stack) getStackPointer() uint16 {
 	return s.stackPointer
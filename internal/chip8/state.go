@@ -0,0 +1,214 @@
+package chip8
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	stateMagic   = "GC8S"
+	StateVersion = 5
+)
+
+var (
+	ErrInvalidState     = errors.New("chip8: not a save state")
+	ErrStateVersion     = errors.New("chip8: unsupported save state version")
+	ErrStateChecksum    = errors.New("chip8: save state checksum mismatch")
+	ErrStateROMMismatch = errors.New("chip8: save state was made with a different ROM")
+	ErrStateQuirks      = errors.New("chip8: save state was made with different quirks")
+)
+
+// stateHeader precedes the payload of a save state
+type stateHeader struct {
+	Magic       [4]byte
+	Version     uint16
+	ROMHash     [sha256.Size]byte
+	Quirks      Quirks
+	PayloadSize uint32
+}
+
+// cpuState is everything in the machine apart from memory and pixels
+type cpuState struct {
+	IRegister    uint16
+	VRegister    [16]uint8
+	Delay        uint8
+	Sound        uint8
+	AudioPattern [16]uint8
+	Pitch        uint8
+	Stack        [16]uint16
+	PC           uint16
+	SP           uint16
+	Keys         [16]uint8
+	RPLFlags     [16]uint8
+	Halted       bool
+	Ticks        int64
+	KeyWait      keyWait
+	Width        uint16
+	Height       uint16
+	Planes       uint8
+	Seed         int64
+	RNGState     uint64
+}
+
+// machineState is the fixed size portion of the payload, the framebuffer
+// pixels follow it with one byte per pixel
+type machineState struct {
+	cpuState
+	Memory [MemoryBufferSize]uint8
+}
+
+// captureCPUState copies everything but memory and pixels into its serializable form
+func (c *Chip8) captureCPUState() cpuState {
+	return cpuState{
+		IRegister:    c.registers.iRegister,
+		VRegister:    c.registers.vRegister,
+		Delay:        c.registers.delay,
+		Sound:        c.registers.sound,
+		AudioPattern: c.registers.audioPattern,
+		Pitch:        c.registers.pitch,
+		Stack:        c.stack.stack,
+		PC:           c.stack.programCounter,
+		SP:           c.stack.stackPointer,
+		Keys:         c.keys,
+		RPLFlags:     c.rplFlags,
+		Halted:       c.halted,
+		Ticks:        c.ticks,
+		KeyWait:      c.keyWait,
+		Width:        c.frameBuf.width,
+		Height:       c.frameBuf.height,
+		Planes:       c.frameBuf.planes,
+		Seed:         c.seed,
+		RNGState:     c.rngState(),
+	}
+}
+
+// rngState returns the position of the random number generator, 0 when it
+// can't be saved
+func (c *Chip8) rngState() uint64 {
+	if rng, ok := c.rng.(StatefulRNG); ok {
+		return rng.State()
+	}
+	return 0
+}
+
+// captureState copies the machine into its serializable form
+func (c *Chip8) captureState() *machineState {
+	return &machineState{
+		cpuState: c.captureCPUState(),
+		Memory:   c.memory.buf,
+	}
+}
+
+// restoreState copies a serialized machine and its pixels back into the chip8
+func (c *Chip8) restoreState(s *machineState, pixels []uint8) {
+	c.registers.iRegister = s.IRegister
+	c.registers.vRegister = s.VRegister
+	c.registers.delay = s.Delay
+	c.registers.sound = s.Sound
+	c.registers.audioPattern = s.AudioPattern
+	c.registers.pitch = s.Pitch
+	c.stack.stack = s.Stack
+	c.stack.programCounter = s.PC
+	c.stack.stackPointer = s.SP
+	c.memory.buf = s.Memory
+	c.keys = s.Keys
+	c.rplFlags = s.RPLFlags
+	c.halted = s.Halted
+	c.ticks = s.Ticks
+	c.keyWait = s.KeyWait
+	c.seed = s.Seed
+	if rng, ok := c.rng.(StatefulRNG); ok {
+		rng.SetState(s.RNGState)
+	}
+	c.fault = nil
+	c.frameBuf.setResolution(s.Width == HiResVideoBufferWidth)
+	c.frameBuf.setPlanes(s.Planes)
+	for i, p := range pixels {
+		c.frameBuf.buf[i] = uint32(p)
+	}
+}
+
+// SaveState writes a snapshot of the full machine to w. The snapshot is
+// tagged with the hash of the loaded ROM and protected by a CRC32 checksum
+func (c *Chip8) SaveState(w io.Writer) error {
+	payload := &bytes.Buffer{}
+	if err := binary.Write(payload, binary.BigEndian, c.captureState()); err != nil {
+		return err
+	}
+	for _, p := range c.frameBuf.getFrameBuffer() {
+		payload.WriteByte(uint8(p))
+	}
+	header := stateHeader{
+		Version:     StateVersion,
+		ROMHash:     c.romHash,
+		Quirks:      c.quirks,
+		PayloadSize: uint32(payload.Len()),
+	}
+	copy(header.Magic[:], stateMagic)
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload.Bytes()); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, crc32.ChecksumIEEE(payload.Bytes()))
+}
+
+// LoadState restores a snapshot written by SaveState. The machine is left
+// untouched if the snapshot is corrupt or was made with a different ROM or
+// quirks
+func (c *Chip8) LoadState(r io.Reader) error {
+	var header stateHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	if string(header.Magic[:]) != stateMagic {
+		return ErrInvalidState
+	}
+	if header.Version != StateVersion {
+		return fmt.Errorf("%w: %d", ErrStateVersion, header.Version)
+	}
+	if header.ROMHash != c.romHash {
+		return ErrStateROMMismatch
+	}
+	if header.Quirks != c.quirks {
+		return ErrStateQuirks
+	}
+	fixedSize := uint32(binary.Size(machineState{}))
+	if header.PayloadSize < fixedSize || header.PayloadSize > fixedSize+HiResVideoBufferWidth*HiResVideoBufferHeight {
+		return ErrInvalidState
+	}
+	payload := make([]byte, header.PayloadSize)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	var checksum uint32
+	if err := binary.Read(r, binary.BigEndian, &checksum); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	if checksum != crc32.ChecksumIEEE(payload) {
+		return ErrStateChecksum
+	}
+	s := &machineState{}
+	if err := binary.Read(bytes.NewReader(payload[:fixedSize]), binary.BigEndian, s); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	pixels := payload[fixedSize:]
+	loRes := s.Width == VideoBufferWidth && s.Height == VideoBufferHeight
+	hiRes := s.Width == HiResVideoBufferWidth && s.Height == HiResVideoBufferHeight
+	if !(loRes || hiRes) || len(pixels) != int(s.Width)*int(s.Height) {
+		return ErrInvalidState
+	}
+	//a checksum only catches accidents, values that would index past the
+	//stack or keypad are rejected too
+	if int(s.SP) > StackDepth || s.KeyWait.Key < -1 || s.KeyWait.Key > 0xF {
+		return ErrInvalidState
+	}
+	c.restoreState(s, pixels)
+	return nil
+}
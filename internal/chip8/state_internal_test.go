@@ -0,0 +1,44 @@
+package chip8
+
+import (
+	"bytes"
+	"errors"
+	"gochip8/internal/clog"
+	"testing"
+)
+
+// TestLoadStateRejectsOutOfRange saves states holding values no running
+// machine can reach, with a valid checksum, and expects LoadState to
+// refuse them instead of panicking on the next cycle
+func TestLoadStateRejectsOutOfRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(c *Chip8)
+	}{
+		{"stack pointer past the stack", func(c *Chip8) { c.stack.stackPointer = uint16(StackDepth + 1) }},
+		{"key wait key past F", func(c *Chip8) { c.keyWait = keyWait{Active: true, Key: 16} }},
+		{"key wait key below -1", func(c *Chip8) { c.keyWait = keyWait{Active: true, Key: -2} }},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := Init(QuirksCOSMACVIP)
+			c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+			c.Load([]byte{0x12, 0x00})
+			tc.corrupt(c)
+			state := &bytes.Buffer{}
+			if err := c.SaveState(state); err != nil {
+				t.Fatal(err)
+			}
+			c = Init(QuirksCOSMACVIP)
+			c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+			c.Load([]byte{0x12, 0x00})
+			if err := c.LoadState(state); !errors.Is(err, ErrInvalidState) {
+				t.Fatalf("LoadState returned %v, want %v", err, ErrInvalidState)
+			}
+			if err := c.Cycle(); err != nil {
+				t.Fatalf("the machine was changed by the rejected state: %v", err)
+			}
+		})
+	}
+}
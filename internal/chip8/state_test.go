@@ -0,0 +1,72 @@
+package chip8_test
+
+import (
+	"bytes"
+	"errors"
+	"gochip8/internal/chip8"
+	"gochip8/internal/clog"
+	"testing"
+)
+
+// draw executes C0FF n times and returns the bytes it drew
+func draw(t *testing.T, c *chip8.Chip8, n int) []uint8 {
+	t.Helper()
+	drawn := make([]uint8, n)
+	for i := range drawn {
+		if err := c.ExecuteOpcode(0xC0FF); err != nil {
+			t.Fatal(err)
+		}
+		drawn[i] = c.GetRegisterState().V[0]
+	}
+	return drawn
+}
+
+func TestLoadStateRestoresRNG(t *testing.T) {
+	for _, name := range chip8.RNGNames() {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			c := chip8.Init(chip8.QuirksCOSMACVIP)
+			c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+			c.Load([]byte{0xC0, 0xFF})
+			if err := c.SelectRNG(name); err != nil {
+				t.Fatal(err)
+			}
+			c.SetSeed(1234)
+			draw(t, c, 5)
+			state := &bytes.Buffer{}
+			if err := c.SaveState(state); err != nil {
+				t.Fatal(err)
+			}
+			want := draw(t, c, 16)
+			c.SetSeed(5678)
+			if err := c.LoadState(state); err != nil {
+				t.Fatal(err)
+			}
+			if got := draw(t, c, 16); !bytes.Equal(got, want) {
+				t.Errorf("drew % X after loading, want % X", got, want)
+			}
+			if c.Seed() != 1234 {
+				t.Errorf("seed is %d after loading, want 1234", c.Seed())
+			}
+		})
+	}
+}
+
+func TestLoadStateRefusesOtherQuirks(t *testing.T) {
+	newChip8 := func(quirks chip8.Quirks) *chip8.Chip8 {
+		c := chip8.Init(quirks)
+		c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+		c.Load([]byte{0x12, 0x00})
+		return c
+	}
+	state := &bytes.Buffer{}
+	if err := newChip8(chip8.QuirksCOSMACVIP).SaveState(state); err != nil {
+		t.Fatal(err)
+	}
+	if err := newChip8(chip8.QuirksSCHIP).LoadState(bytes.NewReader(state.Bytes())); !errors.Is(err, chip8.ErrStateQuirks) {
+		t.Errorf("LoadState under other quirks returned %v, want %v", err, chip8.ErrStateQuirks)
+	}
+	if err := newChip8(chip8.QuirksCOSMACVIP).LoadState(state); err != nil {
+		t.Errorf("LoadState under the same quirks returned %v", err)
+	}
+}
@@ -1,14 +1,15 @@
 package chip8
 
 import (
+	"crypto/sha256"
 	"fmt"
-	"math/rand"
-	"time"
+	"gochip8/internal/clog"
 )
 
-// random number generator for the chip8
+// random number generator for the chip8, drawn from the seeded RNG so a
+// run can be reproduced
 func (c *Chip8) rand() uint8 {
-	return uint8(rand.New(rand.NewSource(time.Now().UnixMilli())).Intn(255))
+	return c.rng.Byte()
 }
 
 // grabs opcode from combining the current and next memory addresses
@@ -18,33 +19,224 @@ func (c *Chip8) fetchOpcode() {
 	c.opcode = Opcode((uint16(addrVal)<<8 | uint16(addrValInc)))
 }
 
-// cycles through the chip8
-func (c *Chip8) cycle() {
+// cycles through the chip8, returning the fault that stopped it under the
+// strict error policy
+func (c *Chip8) cycle() error {
+	if c.halted {
+		return nil
+	}
+	if c.fault != nil {
+		return c.fault
+	}
+	c.opcodeAddr = c.stack.getProgramCounter()
+	c.memory.outOfBounds = false
 	c.fetchOpcode()
+	return c.execute()
+}
+
+// execute runs the fetched opcode and handles any fault it raised
+func (c *Chip8) execute() error {
 	c.stack.incrementProgramCounter()
 	c.executeCurrentInstruction()
-	c.registers.decrementDelay()
-	c.registers.decrementSound()
+	if c.memory.outOfBounds {
+		c.fail(ErrMemoryOutOfBounds)
+	}
+	if c.fault != nil {
+		if c.policy == Strict {
+			c.stack.setProgramCounter(c.opcodeAddr)
+			return c.fault
+		}
+		c.logger.Info().Msg(fmt.Sprintf("Ignoring fault: %v", c.fault))
+		c.fault = nil
+	}
 	c.ticks++
 	c.logger.Info().Msg(fmt.Sprintf("Frame end: I: %d, sp: %X pc: %d, op: %X, shift: %X, vx: %X, vy: %d, nn: %X, tick: %d", c.registers.getIRegister(), c.stack.getStackPointer(), c.stack.getProgramCounter(), c.opcode, c.opcode.opDecode(), c.opcode.vx(), c.opcode.vy(), c.opcode.nn(), c.ticks))
+	return nil
+}
+
+// decrements the delay and sound timers, called at 60 Hz
+func (c *Chip8) tickTimers() {
+	defer c.clearKeyEdges()
+	if c.keyWait.Active && c.quirks.KeyWaitPausesTimers {
+		c.beeping = false
+		return
+	}
+	c.beeping = c.registers.getSound() > 0
+	c.registers.decrementDelay()
+	c.registers.decrementSound()
+}
+
+// public method for external pkg to call chip8 cycle, under the strict
+// error policy it returns the fault that stopped the program
+func (c *Chip8) Cycle() error {
+	return c.cycle()
+}
+
+// public method for external pkg to execute a single opcode at the program
+// counter as if it had been fetched from memory, used by the opcode tests
+func (c *Chip8) ExecuteOpcode(op uint16) error {
+	if c.fault != nil {
+		return c.fault
+	}
+	c.opcodeAddr = c.stack.getProgramCounter()
+	c.memory.outOfBounds = false
+	c.opcode = Opcode(op)
+	return c.execute()
+}
+
+// public method for external pkg to tick the 60 Hz timers
+func (c *Chip8) TickTimers() {
+	c.tickTimers()
+}
+
+// public method for external pkg to run one 60 Hz frame: ipf cycles
+// followed by a single timer tick. A fault ends the frame early without
+// ticking the timers
+func (c *Chip8) RunFrame(ipf int) error {
+	for i := 0; i < ipf && !c.halted; i++ {
+		if err := c.cycle(); err != nil {
+			return err
+		}
+	}
+	c.tickTimers()
+	return nil
 }
 
-// public method for external pkg to call chip8 cycle
-func (c *Chip8) Cycle() {
-	c.cycle()
+// public method for external pkg to get a copy of the display buffer
+func (c *Chip8) GetDisplayBuffer() []uint32 {
+	buf := c.frameBuf.getFrameBuffer()
+	return append(make([]uint32, 0, len(buf)), buf...)
 }
 
-// public method for external pkg to get display buffer
-func (c *Chip8) GetDisplayBuffer() [2048]uint32 {
+// public method for external pkg to read the display buffer without
+// copying it, the slice changes as the chip8 runs and must not be modified
+func (c *Chip8) DisplayView() []uint32 {
 	return c.frameBuf.getFrameBuffer()
 }
 
-// public method for external pkg to load ROM into memory
-func (c *Chip8) Load(rom []byte) {
+// public method for external pkg to get the active display resolution
+func (c *Chip8) GetDisplaySize() (int, int) {
+	return int(c.frameBuf.getWidth()), int(c.frameBuf.getHeight())
+}
+
+// public method for external pkg to get the XO-CHIP audio pattern and pitch
+func (c *Chip8) GetAudioPattern() ([16]uint8, uint8) {
+	return c.registers.getAudioPattern(), c.registers.getPitch()
+}
+
+// public method for external pkg to check whether the buzzer sounded during
+// the last frame
+func (c *Chip8) Beeping() bool {
+	return c.beeping
+}
+
+// public method for external pkg to check whether FX0A is blocked waiting
+// for a key
+func (c *Chip8) WaitingForKey() bool {
+	return c.keyWait.Active
+}
+
+// public method for external pkg to check whether the ROM executed 00FD
+func (c *Chip8) Halted() bool {
+	return c.halted
+}
+
+// public method for external pkg to load ROM into memory, memory is left
+// untouched when the ROM doesn't fit
+func (c *Chip8) Load(rom []byte) error {
+	if space := MemoryBufferSize - StartAddr; len(rom) > space {
+		return fmt.Errorf("%w: %d bytes, at most %d fit", ErrROMTooLarge, len(rom), space)
+	}
 	c.memory.loadROM(rom)
+	c.romHash = sha256.Sum256(rom)
+	return nil
+}
+
+// public method for external pkg to reseed the random number generator,
+// runs with the same seed, ROM and input produce the same results
+func (c *Chip8) SetSeed(seed int64) {
+	c.seed = seed
+	c.rng.Seed(seed)
+}
+
+// public method for external pkg to get the seed of the random number generator
+func (c *Chip8) Seed() int64 {
+	return c.seed
+}
+
+// public method for external pkg to get the SHA-256 of the loaded ROM
+func (c *Chip8) ROMHash() [32]byte {
+	return c.romHash
+}
+
+// public method for external pkg to replace the logger, e.g. with a
+// log without writers to silence per-cycle tracing
+func (c *Chip8) SetLogger(logger *clog.Log) {
+	c.logger = logger
+}
+
+// public method for external pkg to get a snapshot of the registers
+func (c *Chip8) GetRegisterState() RegisterState {
+	return RegisterState{
+		V:             c.registers.vRegister,
+		I:             c.registers.getIRegister(),
+		PC:            c.stack.getProgramCounter(),
+		SP:            c.stack.getStackPointer(),
+		Stack:         c.stack.stack,
+		Delay:         c.registers.getDelay(),
+		Sound:         c.registers.getSound(),
+		Ticks:         c.ticks,
+		Halted:        c.halted,
+		WaitingForKey: c.keyWait.Active,
+	}
+}
+
+// public method for external pkg to set a V register
+func (c *Chip8) SetVRegister(register uint8, value uint8) {
+	c.registers.setVRegister(uint16(register&0xF), value)
+}
+
+// public method for external pkg to set the I register
+func (c *Chip8) SetIRegister(value uint16) {
+	c.registers.setIRegister(value)
+}
+
+// public method for external pkg to set the program counter
+func (c *Chip8) SetProgramCounter(pc uint16) {
+	c.stack.setProgramCounter(pc)
+}
+
+// public method for external pkg to set the call stack, addrs holds the
+// return addresses from the outermost call in, up to StackDepth deep
+func (c *Chip8) SetStack(addrs []uint16) {
+	addrs = addrs[:min(len(addrs), StackDepth)]
+	c.stack.stack = [16]uint16{}
+	copy(c.stack.stack[1:], addrs)
+	c.stack.stackPointer = uint16(len(addrs))
+}
+
+// public method for external pkg to replace the display, buf holds the
+// lit planes of each pixel at the active resolution
+func (c *Chip8) SetDisplayBuffer(buf []uint32) {
+	copy(c.frameBuf.getFrameBuffer(), buf)
+}
+
+// public method for external pkg to set the delay timer
+func (c *Chip8) SetDelayTimer(value uint8) {
+	c.registers.setDelay(value)
+}
+
+// public method for external pkg to set the sound timer
+func (c *Chip8) SetSoundTimer(value uint8) {
+	c.registers.setSound(value)
+}
+
+// public method for external pkg to read a byte of memory
+func (c *Chip8) ReadMemory(address uint16) uint8 {
+	return c.memory.read(address)
 }
 
-// public method for external pkg to get keys
-func (c *Chip8) GetKeys() *[16]uint8 {
-	return &[16]uint8{}
+// public method for external pkg to write a byte of memory
+func (c *Chip8) WriteMemory(address uint16, value uint8) {
+	c.memory.write(address, value)
 }
@@ -83,25 +83,35 @@ func findLogFile(name string) *os.File {
 	return logFile
 }
 
+// NewLog creates a log writing to stdout and to a file named after the app,
+// the file is skipped when it can't be created
 func NewLog(level int, name, appname string) *Log {
-	stdoutWriter := NewClogFileWriter(os.Stdout)
+	writers := map[string]io.Writer{
+		"stdout": NewClogFileWriter(os.Stdout),
+	}
 	fn := fmt.Sprintf("/Users/daniel.dailey/tmp/%s.log", appname)
 	logFile := findLogFile(fn)
 	if logFile == nil {
 		newLogFile, err := os.Create(fn)
-		if err != nil {
-			panic(err)
+		if err == nil {
+			logFile = newLogFile
 		}
-		logFile = newLogFile
 	}
-	fileWriter := NewClogFileWriter(logFile)
-	logger := &Log{
-		level: LogLevel(level),
-		name:  name,
-		writers: map[string]io.Writer{
-			"stdout": stdoutWriter,
-			"file":   fileWriter,
-		},
+	if logFile != nil {
+		writers["file"] = NewClogFileWriter(logFile)
+	}
+	return NewLogWithWriters(level, name, writers)
+}
+
+// NewLogWithWriters creates a log writing to the given writers,
+// a log without writers discards every message
+func NewLogWithWriters(level int, name string, writers map[string]io.Writer) *Log {
+	if writers == nil {
+		writers = map[string]io.Writer{}
+	}
+	return &Log{
+		level:   LogLevel(level),
+		name:    name,
+		writers: writers,
 	}
-	return logger
 }
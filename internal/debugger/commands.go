@@ -0,0 +1,378 @@
+package debugger
+
+import (
+	"fmt"
+	"gochip8/internal/chip8"
+	"gochip8/internal/disasm"
+	"strconv"
+	"strings"
+)
+
+const help = `commands:
+  break|b <addr> [if <reg> <op> <value>]  set a breakpoint, optionally conditional
+                                          on v0-vf, i, pc, sp, dt or st with
+                                          ==, !=, <, <=, > or >=
+  delete|d <addr>|all                     remove breakpoints
+  breakpoints|bl                          list breakpoints
+  step|s [n]                              execute n instructions (default 1)
+  next|n                                  step over a 2NNN call
+  finish|out|o                            run until the current subroutine returns
+  continue|c                              resume execution
+  pause|p                                 stop execution
+  regs|r                                  show registers
+  stack [level addr]                      show the call stack, or set the return
+                                          address at a level it lists
+  mem|x <addr> [len]                      dump memory
+  set <reg> <value>                       set v0-vf, i, pc, sp, dt or st
+  poke <addr> <byte>...                   write bytes to memory
+  list|l [addr] [count]                   disassemble around addr (default pc)
+  help|h                                  show this help
+  quit|q                                  exit`
+
+// parseNumber parses a decimal or 0x prefixed hex number
+func parseNumber(s string, bits int) (uint64, error) {
+	return strconv.ParseUint(s, 0, bits)
+}
+
+// execute runs a single command line
+func (d *Debugger) execute(line string) {
+	fields := strings.Fields(strings.ToLower(line))
+	if len(fields) == 0 {
+		return
+	}
+	args := fields[1:]
+	var err error
+	switch fields[0] {
+	case "break", "b":
+		err = d.cmdBreak(args)
+	case "delete", "d":
+		err = d.cmdDelete(args)
+	case "breakpoints", "bl":
+		d.cmdBreakpoints()
+	case "step", "s":
+		err = d.cmdStep(args)
+	case "next", "n":
+		d.cmdNext()
+	case "finish", "out", "o":
+		d.cmdFinish()
+	case "continue", "c":
+		d.paused = false
+	case "pause", "p":
+		d.pause("paused")
+	case "regs", "r":
+		d.printRegisters()
+	case "stack":
+		err = d.cmdStack(args)
+	case "mem", "x":
+		err = d.cmdMem(args)
+	case "set":
+		err = d.cmdSet(args)
+	case "poke":
+		err = d.cmdPoke(args)
+	case "list", "l":
+		err = d.cmdList(args)
+	case "help", "h":
+		fmt.Fprintln(d.out, help)
+	case "quit", "q":
+		d.quit = true
+	default:
+		err = fmt.Errorf("unknown command %q, try help", fields[0])
+	}
+	if err != nil {
+		fmt.Fprintln(d.out, "error:", err)
+	}
+}
+
+func (d *Debugger) cmdBreak(args []string) error {
+	if len(args) != 1 && len(args) != 5 {
+		return fmt.Errorf("usage: break <addr> [if <reg> <op> <value>]")
+	}
+	addr, err := parseNumber(args[0], 16)
+	if err != nil {
+		return err
+	}
+	bp := &Breakpoint{Addr: uint16(addr)}
+	if len(args) == 5 {
+		if args[1] != "if" {
+			return fmt.Errorf("expected if, got %q", args[1])
+		}
+		if _, ok := registerValue(chip8.RegisterState{}, args[2]); !ok {
+			return fmt.Errorf("unknown register %q", args[2])
+		}
+		switch args[3] {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return fmt.Errorf("unknown comparison %q", args[3])
+		}
+		val, err := parseNumber(args[4], 16)
+		if err != nil {
+			return err
+		}
+		bp.Cond = &Condition{Register: args[2], Op: args[3], Value: uint16(val)}
+	}
+	d.breakpoints[bp.Addr] = bp
+	fmt.Fprintf(d.out, "breakpoint at 0x%03X\n", bp.Addr)
+	return nil
+}
+
+func (d *Debugger) cmdDelete(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: delete <addr>|all")
+	}
+	if args[0] == "all" {
+		d.breakpoints = map[uint16]*Breakpoint{}
+		return nil
+	}
+	addr, err := parseNumber(args[0], 16)
+	if err != nil {
+		return err
+	}
+	if _, ok := d.breakpoints[uint16(addr)]; !ok {
+		return fmt.Errorf("no breakpoint at 0x%03X", addr)
+	}
+	delete(d.breakpoints, uint16(addr))
+	return nil
+}
+
+func (d *Debugger) cmdBreakpoints() {
+	for _, bp := range d.sortedBreakpoints() {
+		if bp.Name != "" {
+			fmt.Fprintf(d.out, "0x%03X %s\n", bp.Addr, bp.Name)
+			continue
+		}
+		if bp.Cond != nil {
+			fmt.Fprintf(d.out, "0x%03X if %s\n", bp.Addr, bp.Cond)
+			continue
+		}
+		fmt.Fprintf(d.out, "0x%03X\n", bp.Addr)
+	}
+}
+
+func (d *Debugger) cmdStep(args []string) error {
+	n := uint64(1)
+	if len(args) > 0 {
+		var err error
+		if n, err = parseNumber(args[0], 32); err != nil {
+			return err
+		}
+	}
+	for i := uint64(0); i < n && !d.chip8.Halted(); i++ {
+		if err := d.chip8.Cycle(); err != nil {
+			fmt.Fprintln(d.out, err)
+			break
+		}
+	}
+	d.printDisassembly(d.chip8.GetRegisterState().PC, 3)
+	return nil
+}
+
+// cmdNext steps over a 2NNN call by running until the instruction after it
+// is reached at the same stack depth, any other instruction is single stepped
+func (d *Debugger) cmdNext() {
+	state := d.chip8.GetRegisterState()
+	if d.chip8.ReadMemory(state.PC)>>4 != chip8.SUBROUTINE {
+		d.cmdStep(nil)
+		return
+	}
+	returnAddr, depth := state.PC+2, state.SP
+	d.stopWhen = func(s chip8.RegisterState) bool {
+		return s.PC == returnAddr && s.SP == depth
+	}
+	d.paused = false
+}
+
+// cmdFinish runs until the current subroutine returns to its caller
+func (d *Debugger) cmdFinish() {
+	depth := d.chip8.GetRegisterState().SP
+	if depth == 0 {
+		fmt.Fprintln(d.out, "error: not in a subroutine")
+		return
+	}
+	d.stopWhen = func(s chip8.RegisterState) bool {
+		return s.SP < depth
+	}
+	d.paused = false
+}
+
+func (d *Debugger) cmdMem(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: mem <addr> [len]")
+	}
+	addr, err := parseNumber(args[0], 16)
+	if err != nil {
+		return err
+	}
+	length := uint64(64)
+	if len(args) == 2 {
+		if length, err = parseNumber(args[1], 16); err != nil {
+			return err
+		}
+	}
+	for row := uint64(0); row < length; row += 16 {
+		fmt.Fprintf(d.out, "%04X:", uint16(addr+row))
+		for col := row; col < row+16 && col < length; col++ {
+			fmt.Fprintf(d.out, " %02X", d.chip8.ReadMemory(uint16(addr+col)))
+		}
+		fmt.Fprintln(d.out)
+	}
+	return nil
+}
+
+func (d *Debugger) cmdSet(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: set <reg> <value>")
+	}
+	val, err := parseNumber(args[1], 16)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "i":
+		d.chip8.SetIRegister(uint16(val))
+	case "pc":
+		d.chip8.SetProgramCounter(uint16(val))
+	case "sp":
+		//entries above the old stack pointer keep whatever they last held
+		if val > uint64(chip8.StackDepth) {
+			return fmt.Errorf("sp %d is deeper than the %d level stack", val, chip8.StackDepth)
+		}
+		s := d.chip8.GetRegisterState()
+		d.chip8.SetStack(s.Stack[1 : val+1])
+	case "dt":
+		d.chip8.SetDelayTimer(uint8(val))
+	case "st":
+		d.chip8.SetSoundTimer(uint8(val))
+	default:
+		v, ok := vRegisterIndex(args[0])
+		if !ok {
+			return fmt.Errorf("unknown register %q", args[0])
+		}
+		if val > 0xFF {
+			return fmt.Errorf("value 0x%X does not fit in %s", val, args[0])
+		}
+		d.chip8.SetVRegister(v, uint8(val))
+	}
+	return nil
+}
+
+// cmdStack prints the call stack, or with a level and an address replaces
+// the return address at that level, numbered as printStack lists them
+func (d *Debugger) cmdStack(args []string) error {
+	if len(args) == 0 {
+		d.printStack()
+		return nil
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: stack [level addr]")
+	}
+	level, err := parseNumber(args[0], 8)
+	if err != nil {
+		return err
+	}
+	addr, err := parseNumber(args[1], 16)
+	if err != nil {
+		return err
+	}
+	s := d.chip8.GetRegisterState()
+	if level >= uint64(s.SP) {
+		return fmt.Errorf("level %d is not on the stack, it holds %d, set sp to deepen it", level, s.SP)
+	}
+	addrs := s.Stack[1 : s.SP+1]
+	addrs[len(addrs)-1-int(level)] = uint16(addr)
+	d.chip8.SetStack(addrs)
+	return nil
+}
+
+func (d *Debugger) cmdPoke(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: poke <addr> <byte>...")
+	}
+	addr, err := parseNumber(args[0], 16)
+	if err != nil {
+		return err
+	}
+	for i, arg := range args[1:] {
+		b, err := parseNumber(arg, 8)
+		if err != nil {
+			return err
+		}
+		d.chip8.WriteMemory(uint16(addr)+uint16(i), uint8(b))
+	}
+	return nil
+}
+
+func (d *Debugger) cmdList(args []string) error {
+	addr := uint64(d.chip8.GetRegisterState().PC)
+	count := uint64(8)
+	var err error
+	if len(args) > 0 {
+		if addr, err = parseNumber(args[0], 16); err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 {
+		if count, err = parseNumber(args[1], 16); err != nil {
+			return err
+		}
+	}
+	d.printDisassembly(uint16(addr), int(count))
+	return nil
+}
+
+func (d *Debugger) printRegisters() {
+	s := d.chip8.GetRegisterState()
+	for i, v := range s.V {
+		fmt.Fprintf(d.out, "V%X=%02X ", i, v)
+		if i == 7 {
+			fmt.Fprintln(d.out)
+		}
+	}
+	fmt.Fprintf(d.out, "\nI=%03X PC=%03X SP=%X DT=%02X ST=%02X ticks=%d\n", s.I, s.PC, s.SP, s.Delay, s.Sound, s.Ticks)
+	if s.WaitingForKey {
+		fmt.Fprintln(d.out, "waiting for a key")
+	}
+}
+
+func (d *Debugger) printStack() {
+	s := d.chip8.GetRegisterState()
+	if s.SP == 0 {
+		fmt.Fprintln(d.out, "stack is empty")
+		return
+	}
+	for i := s.SP; i > 0; i-- {
+		fmt.Fprintf(d.out, "#%d return to 0x%03X\n", s.SP-i, s.Stack[i])
+	}
+}
+
+// printDisassembly lists count instructions before and after addr,
+// marking the program counter and breakpoints
+func (d *Debugger) printDisassembly(addr uint16, count int) {
+	pc := d.chip8.GetRegisterState().PC
+	//count with ints clamped to memory, a uint16 would wrap at the end of
+	//memory and never stop
+	start := max(int(addr)-count*2, int(addr)%2)
+	end := min(int(addr)+count*2, chip8.MemoryBufferSize-1)
+	for i := start; i <= end; {
+		a := uint16(i)
+		marker := "  "
+		if a == pc {
+			marker = "=>"
+		}
+		if _, ok := d.breakpoints[a]; ok {
+			marker = marker[:1] + "*"
+		}
+		op := chip8.Opcode(d.readWord(a))
+		raw := fmt.Sprintf("%04X", uint16(op))
+		size := disasm.Size(op)
+		if size == 4 {
+			raw += fmt.Sprintf(" %04X", d.readWord(a+2))
+		}
+		fmt.Fprintf(d.out, "%s %03X: %-9s %s\n", marker, a, raw, disasm.Format(op, d.readWord(a+2), disasm.Cowgod, nil))
+		i += size
+	}
+}
+
+// readWord reads the big endian word at addr
+func (d *Debugger) readWord(addr uint16) uint16 {
+	return uint16(d.chip8.ReadMemory(addr))<<8 | uint16(d.chip8.ReadMemory(addr+1))
+}
@@ -0,0 +1,224 @@
+// Package debugger is an interactive terminal debugger for the chip8
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"gochip8/internal/chip8"
+	"io"
+	"sort"
+)
+
+// Condition compares a register against a value, e.g. v3 == 0x10
+type Condition struct {
+	Register string
+	Op       string
+	Value    uint16
+}
+
+// Breakpoint pauses execution when the program counter reaches Addr
+// and the optional condition holds
+type Breakpoint struct {
+	Addr uint16
+	Cond *Condition
+	// Name labels breakpoints that came from the program source, such as
+	// Octo :breakpoint directives
+	Name string
+}
+
+// Debugger controls a chip8 from commands read on a terminal. Commands are
+// read on a background goroutine and applied by RunFrame on the host's
+// thread, so the chip8 is never touched concurrently
+type Debugger struct {
+	chip8       *chip8.Chip8
+	out         io.Writer
+	commands    chan string
+	breakpoints map[uint16]*Breakpoint
+	paused      bool
+	// stopWhen, when set, pauses execution once it returns true; used by
+	// step-over and step-out
+	stopWhen func(chip8.RegisterState) bool
+	quit     bool
+}
+
+// New creates a debugger for c writing to out. The debugger starts paused
+// so breakpoints can be placed before the ROM runs
+func New(c *chip8.Chip8, out io.Writer) *Debugger {
+	return &Debugger{
+		chip8:       c,
+		out:         out,
+		commands:    make(chan string, 16),
+		breakpoints: map[uint16]*Breakpoint{},
+		paused:      true,
+	}
+}
+
+// ReadCommands reads commands line by line from r until it is exhausted,
+// queueing them for the next call to RunFrame
+func (d *Debugger) ReadCommands(r io.Reader) {
+	d.prompt()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		d.commands <- scanner.Text()
+	}
+	d.commands <- "quit"
+}
+
+// Send queues a single command, e.g. from a hotkey in the host
+func (d *Debugger) Send(command string) {
+	d.commands <- command
+}
+
+// AddBreakpoint sets an unconditional breakpoint at addr, name is shown
+// when it is hit and may be empty
+func (d *Debugger) AddBreakpoint(addr uint16, name string) {
+	d.breakpoints[addr] = &Breakpoint{Addr: addr, Name: name}
+}
+
+// Paused reports whether execution is stopped
+func (d *Debugger) Paused() bool {
+	return d.paused
+}
+
+// Quit reports whether the quit command was issued
+func (d *Debugger) Quit() bool {
+	return d.quit
+}
+
+// RunFrame applies pending commands and, unless paused, runs up to ipf
+// instructions stopping at breakpoints. The timers only tick on frames
+// that ran to completion so they stay frozen while paused
+func (d *Debugger) RunFrame(ipf int) {
+	for pending := true; pending; {
+		select {
+		case line := <-d.commands:
+			d.execute(line)
+			if !d.paused {
+				continue
+			}
+			d.prompt()
+		default:
+			pending = false
+		}
+	}
+	if d.paused {
+		return
+	}
+	for i := 0; i < ipf; i++ {
+		if d.chip8.Halted() {
+			d.pause("program exited")
+			return
+		}
+		if err := d.chip8.Cycle(); err != nil {
+			d.pause(err.Error())
+			return
+		}
+		if reason, stop := d.shouldStop(); stop {
+			d.pause(reason)
+			return
+		}
+	}
+	d.chip8.TickTimers()
+}
+
+// shouldStop checks the breakpoints and any pending step-over/out target
+// against the instruction about to execute
+func (d *Debugger) shouldStop() (string, bool) {
+	state := d.chip8.GetRegisterState()
+	if d.stopWhen != nil && d.stopWhen(state) {
+		return "stepped", true
+	}
+	bp, ok := d.breakpoints[state.PC]
+	if !ok {
+		return "", false
+	}
+	if bp.Cond != nil && !bp.Cond.holds(state) {
+		return "", false
+	}
+	if bp.Name != "" {
+		return fmt.Sprintf("breakpoint %s at 0x%03X", bp.Name, bp.Addr), true
+	}
+	return fmt.Sprintf("breakpoint at 0x%03X", bp.Addr), true
+}
+
+// pause stops execution and shows where it stopped
+func (d *Debugger) pause(reason string) {
+	d.paused = true
+	d.stopWhen = nil
+	fmt.Fprintf(d.out, "\n%s\n", reason)
+	d.printDisassembly(d.chip8.GetRegisterState().PC, 3)
+	d.prompt()
+}
+
+func (d *Debugger) prompt() {
+	fmt.Fprint(d.out, "(c8db) ")
+}
+
+// sortedBreakpoints returns the breakpoints ordered by address
+func (d *Debugger) sortedBreakpoints() []*Breakpoint {
+	bps := make([]*Breakpoint, 0, len(d.breakpoints))
+	for _, bp := range d.breakpoints {
+		bps = append(bps, bp)
+	}
+	sort.Slice(bps, func(i, j int) bool { return bps[i].Addr < bps[j].Addr })
+	return bps
+}
+
+// registerValue reads a register named v0-vf, i, pc, sp, dt or st
+func registerValue(state chip8.RegisterState, register string) (uint16, bool) {
+	switch register {
+	case "i":
+		return state.I, true
+	case "pc":
+		return state.PC, true
+	case "sp":
+		return state.SP, true
+	case "dt":
+		return uint16(state.Delay), true
+	case "st":
+		return uint16(state.Sound), true
+	}
+	if v, ok := vRegisterIndex(register); ok {
+		return uint16(state.V[v]), true
+	}
+	return 0, false
+}
+
+// vRegisterIndex parses a V register name such as v7 or vA
+func vRegisterIndex(register string) (uint8, bool) {
+	if len(register) != 2 || register[0] != 'v' {
+		return 0, false
+	}
+	var v uint8
+	if _, err := fmt.Sscanf(register[1:], "%x", &v); err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// holds evaluates the condition against the current registers
+func (cond *Condition) holds(state chip8.RegisterState) bool {
+	val, ok := registerValue(state, cond.Register)
+	if !ok {
+		return false
+	}
+	switch cond.Op {
+	case "==":
+		return val == cond.Value
+	case "!=":
+		return val != cond.Value
+	case "<":
+		return val < cond.Value
+	case "<=":
+		return val <= cond.Value
+	case ">":
+		return val > cond.Value
+	case ">=":
+		return val >= cond.Value
+	}
+	return false
+}
+
+func (cond *Condition) String() string {
+	return fmt.Sprintf("%s %s 0x%X", cond.Register, cond.Op, cond.Value)
+}
@@ -0,0 +1,155 @@
+package debugger_test
+
+import (
+	"bytes"
+	"gochip8/internal/chip8"
+	"gochip8/internal/clog"
+	"gochip8/internal/debugger"
+	"strings"
+	"testing"
+)
+
+// rom calls a subroutine setting V2 then counts up V0 forever
+var rom = []byte{
+	0x22, 0x08, // 200: call 208
+	0x70, 0x01, // 202: V0 += 1
+	0x12, 0x02, // 204: jump 202
+	0x00, 0x00, // 206:
+	0x62, 0x02, // 208: V2 = 2
+	0x00, 0xEE, // 20A: return
+}
+
+const ipf = 100
+
+// newDebugger returns a paused debugger on a silent chip8 running rom and
+// the buffer its output goes to
+func newDebugger(t *testing.T) (*chip8.Chip8, *debugger.Debugger, *bytes.Buffer) {
+	t.Helper()
+	c := chip8.Init(chip8.QuirksCOSMACVIP)
+	c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+	c.Load(rom)
+	out := &bytes.Buffer{}
+	return c, debugger.New(c, out), out
+}
+
+// run sends the commands and runs a frame to apply them
+func run(d *debugger.Debugger, commands ...string) {
+	for _, command := range commands {
+		d.Send(command)
+	}
+	d.RunFrame(ipf)
+}
+
+func TestCommands(t *testing.T) {
+	cases := []struct {
+		name     string
+		commands []string
+		// err is part of the error printed, empty when none is expected
+		err   string
+		check func(s chip8.RegisterState) bool
+	}{
+		{"set a V register", []string{"set vb 0x42"}, "", func(s chip8.RegisterState) bool { return s.V[0xB] == 0x42 }},
+		{"set a V register out of range", []string{"set v1 0x100"}, "does not fit in v1", nil},
+		{"set I", []string{"set i 0x300"}, "", func(s chip8.RegisterState) bool { return s.I == 0x300 }},
+		{"set PC", []string{"set pc 0x204"}, "", func(s chip8.RegisterState) bool { return s.PC == 0x204 }},
+		{"set the timers", []string{"set dt 5", "set st 6"}, "", func(s chip8.RegisterState) bool { return s.Delay == 5 && s.Sound == 6 }},
+		{"set an unknown register", []string{"set vz 1"}, `unknown register "vz"`, nil},
+		{"set SP", []string{"set sp 3"}, "", func(s chip8.RegisterState) bool { return s.SP == 3 }},
+		{"set SP to the stack depth", []string{"set sp 15"}, "", func(s chip8.RegisterState) bool { return int(s.SP) == chip8.StackDepth }},
+		{"set SP past the stack depth", []string{"set sp 16"}, "deeper than the 15 level stack", func(s chip8.RegisterState) bool { return s.SP == 0 }},
+		{
+			"set stack entries", []string{"set sp 2", "stack 0 0x2AA", "stack 1 0x2BB"}, "",
+			func(s chip8.RegisterState) bool { return s.Stack[2] == 0x2AA && s.Stack[1] == 0x2BB },
+		},
+		{"set a stack entry past SP", []string{"set sp 1", "stack 1 0x2AA"}, "level 1 is not on the stack", nil},
+		{"set a stack entry without an address", []string{"stack 0"}, "usage: stack", nil},
+		{"conditional breakpoint", []string{"b 0x202 if v0 >= 0x10"}, "", nil},
+		{"breakpoint on an unknown register", []string{"b 0x202 if vz == 1"}, `unknown register "vz"`, nil},
+		{"breakpoint with an unknown comparison", []string{"b 0x202 if v0 =< 1"}, `unknown comparison "=<"`, nil},
+		{"breakpoint without if", []string{"b 0x202 when v0 == 1"}, `expected if`, nil},
+		{"breakpoint at a bad address", []string{"b zz"}, "invalid syntax", nil},
+		{"delete a missing breakpoint", []string{"d 0x300"}, "no breakpoint at 0x300", nil},
+		{"poke memory", []string{"poke 0x300 1 2"}, "", nil},
+		{"poke a value too big", []string{"poke 0x300 0x100"}, "out of range", nil},
+		{"unknown command", []string{"frob"}, `unknown command "frob"`, nil},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c, d, out := newDebugger(t)
+			run(d, tc.commands...)
+			printed := out.String()
+			if i := strings.Index(printed, "error: "); i >= 0 {
+				printed = printed[i:]
+			} else {
+				printed = ""
+			}
+			switch {
+			case tc.err == "" && printed != "":
+				t.Errorf("unexpected %s", strings.TrimSpace(printed))
+			case tc.err != "" && !strings.Contains(printed, tc.err):
+				t.Errorf("output %q doesn't report %q", out, tc.err)
+			}
+			if tc.check != nil && !tc.check(c.GetRegisterState()) {
+				t.Errorf("registers are %+v after %q", c.GetRegisterState(), tc.commands)
+			}
+			if !d.Paused() {
+				t.Error("the command resumed execution")
+			}
+		})
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	c, d, out := newDebugger(t)
+	run(d, "b 0x208", "b 0x204 if v0 == 3", "bl", "c")
+	if !d.Paused() || c.GetRegisterState().PC != 0x208 {
+		t.Fatalf("stopped at 0x%03X, want the breakpoint at 0x208", c.GetRegisterState().PC)
+	}
+	if !strings.Contains(out.String(), "0x204 if v0 == 0x3") {
+		t.Errorf("breakpoint list missing the condition:\n%s", out)
+	}
+	run(d, "c")
+	if s := c.GetRegisterState(); s.PC != 0x204 || s.V[0] != 3 {
+		t.Fatalf("stopped at 0x%03X with V0=%d, want 0x204 with V0=3", s.PC, s.V[0])
+	}
+	run(d, "d all", "c")
+	if d.Paused() {
+		t.Error("paused after deleting every breakpoint")
+	}
+}
+
+func TestStepping(t *testing.T) {
+	c, d, _ := newDebugger(t)
+	run(d, "s")
+	if s := c.GetRegisterState(); s.PC != 0x208 || s.SP != 1 {
+		t.Fatalf("step into the call left PC=0x%03X SP=%d, want 0x208 and 1", s.PC, s.SP)
+	}
+	run(d, "o")
+	if s := c.GetRegisterState(); !d.Paused() || s.PC != 0x202 || s.SP != 0 || s.V[2] != 2 {
+		t.Fatalf("finish left PC=0x%03X SP=%d V2=%d, want 0x202, 0 and 2", s.PC, s.SP, s.V[2])
+	}
+	run(d, "s 4")
+	if s := c.GetRegisterState(); s.PC != 0x202 || s.V[0] != 2 {
+		t.Fatalf("4 steps left PC=0x%03X V0=%d, want 0x202 and 2", s.PC, s.V[0])
+	}
+
+	c, d, _ = newDebugger(t)
+	run(d, "n")
+	if s := c.GetRegisterState(); !d.Paused() || s.PC != 0x202 || s.SP != 0 || s.V[2] != 2 {
+		t.Fatalf("step over the call left PC=0x%03X SP=%d V2=%d, want 0x202, 0 and 2", s.PC, s.SP, s.V[2])
+	}
+	run(d, "o")
+	if c.GetRegisterState().PC != 0x202 {
+		t.Error("finish outside a subroutine moved the program counter")
+	}
+}
+
+func TestQuit(t *testing.T) {
+	_, d, _ := newDebugger(t)
+	d.ReadCommands(strings.NewReader("set v0 1\n"))
+	d.RunFrame(ipf)
+	if !d.Quit() {
+		t.Error("running out of commands didn't quit")
+	}
+}
@@ -0,0 +1,278 @@
+package disasm
+
+import (
+	"fmt"
+	"gochip8/internal/chip8"
+	"strings"
+)
+
+// Syntax selects the assembly dialect the disassembler writes
+type Syntax int
+
+const (
+	// Cowgod is the classic mnemonic syntax from Cowgod's technical reference,
+	// e.g. LD V1, 0x2A, and is the syntax the assembler reads
+	Cowgod Syntax = iota
+	// Octo is the syntax of the Octo high level assembler, e.g. v1 := 0x2A
+	Octo
+)
+
+// ParseSyntax looks up a syntax by name
+func ParseSyntax(name string) (Syntax, error) {
+	switch name {
+	case "cowgod", "classic":
+		return Cowgod, nil
+	case "octo":
+		return Octo, nil
+	}
+	return Cowgod, fmt.Errorf("unknown syntax %q, expected cowgod or octo", name)
+}
+
+// Size returns the length in bytes of the instruction starting with op,
+// 4 for the XO-CHIP F000 NNNN long load and 2 for everything else
+func Size(op chip8.Opcode) int {
+	if op == 0xF000 {
+		return 4
+	}
+	return 2
+}
+
+// Format renders a single instruction. long is the word following op and is
+// only used by F000 NNNN. name turns an address operand into text, so a
+// listing can substitute labels
+func Format(op chip8.Opcode, long uint16, syntax Syntax, name func(uint16) string) string {
+	if name == nil {
+		name = func(addr uint16) string { return fmt.Sprintf("0x%03X", addr) }
+	}
+	if syntax == Octo {
+		return formatOcto(op, long, name)
+	}
+	return formatCowgod(op, long, name)
+}
+
+// formatCowgod renders an instruction in the classic mnemonic syntax
+func formatCowgod(op chip8.Opcode, long uint16, name func(uint16) string) string {
+	x, y, n, nn, nnn := op.X(), op.Y(), op.N(), op.NN(), op.NNN()
+	switch op.Op() {
+	case chip8.T0:
+		switch {
+		case op&0xFFF0 == chip8.SCROLL_DOWN:
+			return fmt.Sprintf("SCD %d", n)
+		case op&0xFFF0 == chip8.SCROLL_UP:
+			return fmt.Sprintf("SCU %d", n)
+		case op == chip8.CLEAR:
+			return "CLS"
+		case op == chip8.RETURN:
+			return "RET"
+		case op == chip8.SCROLL_RIGHT:
+			return "SCR"
+		case op == chip8.SCROLL_LEFT:
+			return "SCL"
+		case op == chip8.EXIT:
+			return "EXIT"
+		case op == chip8.LORES:
+			return "LOW"
+		case op == chip8.HIRES:
+			return "HIGH"
+		}
+	case chip8.JUMP:
+		return "JP " + name(nnn)
+	case chip8.SUBROUTINE:
+		return "CALL " + name(nnn)
+	case chip8.SKIP_EQ:
+		return fmt.Sprintf("SE V%X, 0x%02X", x, nn)
+	case chip8.SKIP_NEQ:
+		return fmt.Sprintf("SNE V%X, 0x%02X", x, nn)
+	case chip8.SKIP_VX_EQ_VY:
+		switch n {
+		case chip8.SKIP_VX_EQ_VY_ALT:
+			return fmt.Sprintf("SE V%X, V%X", x, y)
+		case chip8.SAVE_VX_VY:
+			return fmt.Sprintf("SAVE V%X, V%X", x, y)
+		case chip8.LOAD_VX_VY:
+			return fmt.Sprintf("LOAD V%X, V%X", x, y)
+		}
+	case chip8.SET_VX_NN:
+		return fmt.Sprintf("LD V%X, 0x%02X", x, nn)
+	case chip8.VX_INC_NN:
+		return fmt.Sprintf("ADD V%X, 0x%02X", x, nn)
+	case chip8.T8:
+		mnemonic, ok := map[uint8]string{
+			chip8.COPY_V_REGISTER: "LD",
+			chip8.OR_V_REGISTER:   "OR",
+			chip8.AND_V_REGISTER:  "AND",
+			chip8.XOR_V_REGISTER:  "XOR",
+			chip8.SUM_V_REGISTER:  "ADD",
+			chip8.DECREMENT_VX:    "SUB",
+			chip8.SHIFT_RIGHT:     "SHR",
+			chip8.DIFF_V_REGISTER: "SUBN",
+			chip8.SHIFT_LEFT:      "SHL",
+		}[n]
+		if ok {
+			return fmt.Sprintf("%s V%X, V%X", mnemonic, x, y)
+		}
+	case chip8.SKIP_VX_NEQ_VY:
+		if n == 0 {
+			return fmt.Sprintf("SNE V%X, V%X", x, y)
+		}
+	case chip8.SET_I_NNN:
+		return "LD I, " + name(nnn)
+	case chip8.JMP_NNN_V0:
+		return "JP V0, " + name(nnn)
+	case chip8.RAND_NN_MASK:
+		return fmt.Sprintf("RND V%X, 0x%02X", x, nn)
+	case chip8.DRAW:
+		return fmt.Sprintf("DRW V%X, V%X, %d", x, y, n)
+	case chip8.TE:
+		switch nn {
+		case chip8.SKIP_ON_KEY_PRESSED:
+			return fmt.Sprintf("SKP V%X", x)
+		case chip8.SKIP_ON_KEY_RELEASED:
+			return fmt.Sprintf("SKNP V%X", x)
+		}
+	case chip8.TF:
+		switch {
+		case op == 0xF000:
+			return "LDL I, " + name(long)
+		case nn == chip8.SELECT_PLANE:
+			return fmt.Sprintf("PLANE %d", x)
+		case op == 0xF002:
+			return "AUDIO"
+		}
+		format, ok := map[uint8]string{
+			chip8.SET_VX_DELAY_TIMER:  "LD V%X, DT",
+			chip8.WAIT_FOR_KEY:        "LD V%X, K",
+			chip8.SET_DELAY_TIMER_VX:  "LD DT, V%X",
+			chip8.SET_SOUND_TIMER:     "LD ST, V%X",
+			chip8.ADD_VX_TO_I:         "ADD I, V%X",
+			chip8.SET_I_TO_SPRITE:     "LD F, V%X",
+			chip8.SET_I_TO_BIG_SPRITE: "LD HF, V%X",
+			chip8.SET_BCD:             "LD B, V%X",
+			chip8.SET_PITCH:           "LD PITCH, V%X",
+			chip8.REG_DUMP:            "LD [I], V%X",
+			chip8.READ_REGISTERS:      "LD V%X, [I]",
+			chip8.SAVE_RPL_FLAGS:      "LD R, V%X",
+			chip8.LOAD_RPL_FLAGS:      "LD V%X, R",
+		}[nn]
+		if ok {
+			return fmt.Sprintf(format, x)
+		}
+	}
+	return fmt.Sprintf("dw 0x%04X", uint16(op))
+}
+
+// formatOcto renders an instruction in Octo syntax
+func formatOcto(op chip8.Opcode, long uint16, name func(uint16) string) string {
+	x, y, n, nn, nnn := op.X(), op.Y(), op.N(), op.NN(), op.NNN()
+	switch op.Op() {
+	case chip8.T0:
+		switch {
+		case op&0xFFF0 == chip8.SCROLL_DOWN:
+			return fmt.Sprintf("scroll-down %d", n)
+		case op&0xFFF0 == chip8.SCROLL_UP:
+			return fmt.Sprintf("scroll-up %d", n)
+		case op == chip8.CLEAR:
+			return "clear"
+		case op == chip8.RETURN:
+			return "return"
+		case op == chip8.SCROLL_RIGHT:
+			return "scroll-right"
+		case op == chip8.SCROLL_LEFT:
+			return "scroll-left"
+		case op == chip8.EXIT:
+			return "exit"
+		case op == chip8.LORES:
+			return "lores"
+		case op == chip8.HIRES:
+			return "hires"
+		}
+	case chip8.JUMP:
+		return "jump " + name(nnn)
+	case chip8.SUBROUTINE:
+		//Octo calls a label by naming it, numeric targets need :call
+		target := name(nnn)
+		if strings.HasPrefix(target, "0x") {
+			return ":call " + target
+		}
+		return target
+	case chip8.SKIP_EQ:
+		return fmt.Sprintf("if v%x != 0x%02X then", x, nn)
+	case chip8.SKIP_NEQ:
+		return fmt.Sprintf("if v%x == 0x%02X then", x, nn)
+	case chip8.SKIP_VX_EQ_VY:
+		switch n {
+		case chip8.SKIP_VX_EQ_VY_ALT:
+			return fmt.Sprintf("if v%x != v%x then", x, y)
+		case chip8.SAVE_VX_VY:
+			return fmt.Sprintf("save v%x - v%x", x, y)
+		case chip8.LOAD_VX_VY:
+			return fmt.Sprintf("load v%x - v%x", x, y)
+		}
+	case chip8.SET_VX_NN:
+		return fmt.Sprintf("v%x := 0x%02X", x, nn)
+	case chip8.VX_INC_NN:
+		return fmt.Sprintf("v%x += 0x%02X", x, nn)
+	case chip8.T8:
+		operator, ok := map[uint8]string{
+			chip8.COPY_V_REGISTER: ":=",
+			chip8.OR_V_REGISTER:   "|=",
+			chip8.AND_V_REGISTER:  "&=",
+			chip8.XOR_V_REGISTER:  "^=",
+			chip8.SUM_V_REGISTER:  "+=",
+			chip8.DECREMENT_VX:    "-=",
+			chip8.SHIFT_RIGHT:     ">>=",
+			chip8.DIFF_V_REGISTER: "=-",
+			chip8.SHIFT_LEFT:      "<<=",
+		}[n]
+		if ok {
+			return fmt.Sprintf("v%x %s v%x", x, operator, y)
+		}
+	case chip8.SKIP_VX_NEQ_VY:
+		if n == 0 {
+			return fmt.Sprintf("if v%x == v%x then", x, y)
+		}
+	case chip8.SET_I_NNN:
+		return "i := " + name(nnn)
+	case chip8.JMP_NNN_V0:
+		return "jump0 " + name(nnn)
+	case chip8.RAND_NN_MASK:
+		return fmt.Sprintf("v%x := random 0x%02X", x, nn)
+	case chip8.DRAW:
+		return fmt.Sprintf("sprite v%x v%x %d", x, y, n)
+	case chip8.TE:
+		switch nn {
+		case chip8.SKIP_ON_KEY_PRESSED:
+			return fmt.Sprintf("if v%x -key then", x)
+		case chip8.SKIP_ON_KEY_RELEASED:
+			return fmt.Sprintf("if v%x key then", x)
+		}
+	case chip8.TF:
+		switch {
+		case op == 0xF000:
+			return "i := long " + name(long)
+		case nn == chip8.SELECT_PLANE:
+			return fmt.Sprintf("plane %d", x)
+		case op == 0xF002:
+			return "audio"
+		}
+		format, ok := map[uint8]string{
+			chip8.SET_VX_DELAY_TIMER:  "v%x := delay",
+			chip8.WAIT_FOR_KEY:        "v%x := key",
+			chip8.SET_DELAY_TIMER_VX:  "delay := v%x",
+			chip8.SET_SOUND_TIMER:     "buzzer := v%x",
+			chip8.ADD_VX_TO_I:         "i += v%x",
+			chip8.SET_I_TO_SPRITE:     "i := hex v%x",
+			chip8.SET_I_TO_BIG_SPRITE: "i := bighex v%x",
+			chip8.SET_BCD:             "bcd v%x",
+			chip8.SET_PITCH:           "pitch := v%x",
+			chip8.REG_DUMP:            "save v%x",
+			chip8.READ_REGISTERS:      "load v%x",
+			chip8.SAVE_RPL_FLAGS:      "saveflags v%x",
+			chip8.LOAD_RPL_FLAGS:      "loadflags v%x",
+		}[nn]
+		if ok {
+			return fmt.Sprintf(format, x)
+		}
+	}
+	return fmt.Sprintf("0x%02X 0x%02X", uint8(op>>8), uint8(op))
+}
@@ -0,0 +1,217 @@
+// Package disasm turns chip8 ROMs back into assembly source
+package disasm
+
+import (
+	"fmt"
+	"gochip8/internal/chip8"
+	"strings"
+)
+
+const bytesPerDataLine = 8
+
+// Options controls a disassembly listing
+type Options struct {
+	Syntax Syntax
+	// Addresses appends the address and raw bytes of each line as a comment
+	Addresses bool
+}
+
+// rom is a ROM image placed at the chip8 start address
+type rom struct {
+	buf []byte
+}
+
+func (r rom) contains(addr uint16) bool {
+	return addr >= chip8.StartAddr && int(addr)-chip8.StartAddr < len(r.buf)
+}
+
+func (r rom) byteAt(addr uint16) uint8 {
+	if !r.contains(addr) {
+		return 0
+	}
+	return r.buf[addr-chip8.StartAddr]
+}
+
+func (r rom) wordAt(addr uint16) uint16 {
+	return uint16(r.byteAt(addr))<<8 | uint16(r.byteAt(addr+1))
+}
+
+// analysis is the result of tracing control flow through a ROM
+type analysis struct {
+	// code maps the address of each reachable instruction to its size
+	code map[uint16]int
+	// labels holds the jump, call and I targets that need a name
+	labels map[uint16]bool
+}
+
+// analyze follows control flow from the start address to separate code
+// from data. Computed jumps (BNNN) can't be followed, so code only reached
+// through them is listed as data
+func analyze(r rom) analysis {
+	a := analysis{code: map[uint16]int{}, labels: map[uint16]bool{}}
+	work := []uint16{chip8.StartAddr}
+	for len(work) > 0 {
+		addr := work[len(work)-1]
+		work = work[:len(work)-1]
+		for r.contains(addr) && r.contains(addr+1) {
+			if _, seen := a.code[addr]; seen {
+				break
+			}
+			op := chip8.Opcode(r.wordAt(addr))
+			size := Size(op)
+			a.code[addr] = size
+			next := addr + uint16(size)
+			switch op.Op() {
+			case chip8.T0:
+				if op == chip8.RETURN || op == chip8.EXIT {
+					next = 0
+				}
+			case chip8.JUMP:
+				a.labels[op.NNN()] = true
+				work = append(work, op.NNN())
+				next = 0
+			case chip8.SUBROUTINE:
+				a.labels[op.NNN()] = true
+				work = append(work, op.NNN())
+			case chip8.SKIP_EQ, chip8.SKIP_NEQ, chip8.SKIP_VX_EQ_VY, chip8.SKIP_VX_NEQ_VY, chip8.TE:
+				//5XY2 and 5XY3 are the XO-CHIP register range save and
+				//load, only 5XY0 and 9XY0 skip
+				if (op.Op() == chip8.SKIP_VX_EQ_VY || op.Op() == chip8.SKIP_VX_NEQ_VY) && op.N() != 0 {
+					break
+				}
+				skipped := next + uint16(Size(chip8.Opcode(r.wordAt(next))))
+				work = append(work, skipped)
+			case chip8.SET_I_NNN:
+				a.labels[op.NNN()] = true
+			case chip8.JMP_NNN_V0:
+				a.labels[op.NNN()] = true
+				next = 0
+			case chip8.TF:
+				if op == 0xF000 {
+					a.labels[r.wordAt(addr+2)] = true
+				}
+			}
+			if next == 0 {
+				break
+			}
+			addr = next
+		}
+	}
+	return a
+}
+
+// labelName names the label at addr
+func labelName(addr uint16, syntax Syntax) string {
+	if syntax == Octo && addr == chip8.StartAddr {
+		return "main"
+	}
+	return fmt.Sprintf("L%03X", addr)
+}
+
+// Disassemble lists the ROM as assembly source. Reachable instructions are
+// decoded, everything else is emitted as data, and every jump, call and I
+// target inside the ROM is given a label
+func Disassemble(buf []byte, opts Options) string {
+	r := rom{buf: buf}
+	a := analyze(r)
+	// only labels that start a line in the listing can be emitted
+	lineStarts := map[uint16]bool{}
+	for addr := uint16(chip8.StartAddr); r.contains(addr); {
+		lineStarts[addr] = true
+		if size, ok := a.code[addr]; ok {
+			addr += uint16(size)
+			continue
+		}
+		addr++
+	}
+	labels := map[uint16]bool{}
+	for addr := range a.labels {
+		if lineStarts[addr] {
+			labels[addr] = true
+		}
+	}
+	name := func(addr uint16) string {
+		if labels[addr] {
+			return labelName(addr, opts.Syntax)
+		}
+		return fmt.Sprintf("0x%03X", addr)
+	}
+	if opts.Syntax == Octo {
+		labels[chip8.StartAddr] = true
+	}
+
+	l := &listing{opts: opts}
+	for addr := uint16(chip8.StartAddr); r.contains(addr); {
+		if labels[addr] {
+			l.label(labelName(addr, opts.Syntax))
+		}
+		if size, ok := a.code[addr]; ok {
+			op := chip8.Opcode(r.wordAt(addr))
+			raw := fmt.Sprintf("%04X", uint16(op))
+			if size == 4 {
+				raw += fmt.Sprintf(" %04X", r.wordAt(addr+2))
+			}
+			l.line(addr, Format(op, r.wordAt(addr+2), opts.Syntax, name), raw)
+			addr += uint16(size)
+			continue
+		}
+		start := addr
+		var data []uint8
+		for r.contains(addr) && len(data) < bytesPerDataLine {
+			if _, isCode := a.code[addr]; isCode || (addr != start && labels[addr]) {
+				break
+			}
+			data = append(data, r.byteAt(addr))
+			addr++
+		}
+		l.data(start, data)
+	}
+	return l.String()
+}
+
+// listing accumulates the lines of a disassembly
+type listing struct {
+	opts Options
+	sb   strings.Builder
+}
+
+func (l *listing) comment() string {
+	if l.opts.Syntax == Octo {
+		return "#"
+	}
+	return ";"
+}
+
+func (l *listing) label(name string) {
+	if l.opts.Syntax == Octo {
+		fmt.Fprintf(&l.sb, ": %s\n", name)
+		return
+	}
+	fmt.Fprintf(&l.sb, "%s:\n", name)
+}
+
+func (l *listing) line(addr uint16, text, raw string) {
+	if !l.opts.Addresses {
+		fmt.Fprintf(&l.sb, "\t%s\n", text)
+		return
+	}
+	fmt.Fprintf(&l.sb, "\t%-24s %s %03X: %s\n", text, l.comment(), addr, raw)
+}
+
+func (l *listing) data(addr uint16, data []uint8) {
+	parts := make([]string, len(data))
+	raw := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = fmt.Sprintf("0x%02X", b)
+		raw[i] = fmt.Sprintf("%02X", b)
+	}
+	text := strings.Join(parts, " ")
+	if l.opts.Syntax == Cowgod {
+		text = "db " + strings.Join(parts, ", ")
+	}
+	l.line(addr, text, strings.Join(raw, ""))
+}
+
+func (l *listing) String() string {
+	return l.sb.String()
+}
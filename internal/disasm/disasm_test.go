@@ -0,0 +1,17 @@
+package disasm_test
+
+import (
+	"gochip8/internal/disasm"
+	"strings"
+	"testing"
+)
+
+// TestRegisterRangeIsNotASkip checks 5XY2 doesn't make the data after a
+// return look reachable
+func TestRegisterRangeIsNotASkip(t *testing.T) {
+	rom := []byte{0x00, 0xE0, 0x51, 0x22, 0x00, 0xEE, 0xA2, 0x10}
+	out := disasm.Disassemble(rom, disasm.Options{})
+	if !strings.Contains(out, "db 0xA2, 0x10") {
+		t.Errorf("the bytes after RET were disassembled as code:\n%s", out)
+	}
+}
@@ -0,0 +1,139 @@
+// Package headless runs the chip8 without a display, for CI and tests
+package headless
+
+import (
+	"bufio"
+	"fmt"
+	"gochip8/internal/audio"
+	"gochip8/internal/chip8"
+	"gochip8/internal/clog"
+	"gochip8/internal/machine"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// KeyEvent presses or releases a keypad key at the start of a frame
+type KeyEvent struct {
+	Frame int
+	Key   uint8
+	Down  bool
+}
+
+// Config controls a headless run
+type Config struct {
+	Quirks chip8.Quirks
+	// IPF is the number of instructions executed per 60 Hz frame
+	IPF int
+	// Frames stops the run after this many frames
+	Frames int
+	// Cycles stops the run after this many instructions, taking
+	// precedence over Frames when set
+	Cycles int
+	// Input is the scripted keypad input, applied at frame boundaries
+	Input []KeyEvent
+	// Seed seeds the random number generator so runs are reproducible
+	Seed int64
+	// RNG names the built-in random number generator, empty for the
+	// default. Run fails on a name missing from chip8.RNGNames
+	RNG string
+	// Audio, when set, renders the buzzer of every frame, write errors are
+	// reported when it is closed
+	Audio *audio.Beeper
+	// Display, when set, is presented the screen at the end of every frame
+	Display machine.Display
+	// ErrorPolicy decides whether Run stops at the first fault
+	ErrorPolicy chip8.ErrorPolicy
+}
+
+// Run loads the ROM into a fresh chip8 and runs it until the configured
+// number of frames or cycles has elapsed, the ROM exits or it faults. The
+// chip8 is returned along with the fault so its state can be inspected,
+// it is nil when the ROM doesn't fit or the RNG is unknown
+func Run(rom []byte, cfg Config) (*chip8.Chip8, error) {
+	c := chip8.Init(cfg.Quirks)
+	c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+	if err := c.Load(rom); err != nil {
+		return nil, fmt.Errorf("headless: %w", err)
+	}
+	if cfg.RNG != "" {
+		if err := c.SelectRNG(cfg.RNG); err != nil {
+			return nil, fmt.Errorf("headless: %w", err)
+		}
+	}
+	c.SetSeed(cfg.Seed)
+	c.SetErrorPolicy(cfg.ErrorPolicy)
+	return c, Continue(c, cfg)
+}
+
+// Continue runs an already loaded chip8 as configured by cfg, with frame
+// numbers in cfg.Input counted from the start of this call. It returns the
+// fault that stopped a strict chip8
+func Continue(c *chip8.Chip8, cfg Config) error {
+	ipf := cfg.IPF
+	if ipf < 1 {
+		ipf = chip8.DefaultIPF
+	}
+	events := append([]KeyEvent(nil), cfg.Input...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Frame < events[j].Frame })
+	cycles := 0
+	for frame := 0; !c.Halted(); frame++ {
+		if cfg.Cycles <= 0 && frame >= cfg.Frames {
+			return nil
+		}
+		for len(events) > 0 && events[0].Frame <= frame {
+			if events[0].Down {
+				c.KeyDown(events[0].Key)
+			} else {
+				c.KeyUp(events[0].Key)
+			}
+			events = events[1:]
+		}
+		for i := 0; i < ipf && !c.Halted(); i++ {
+			if cfg.Cycles > 0 && cycles >= cfg.Cycles {
+				return nil
+			}
+			if err := c.Cycle(); err != nil {
+				return err
+			}
+			cycles++
+		}
+		c.TickTimers()
+		if cfg.Audio != nil {
+			cfg.Audio.Frame(c.Beeping())
+		}
+		if cfg.Display != nil {
+			width, height := c.GetDisplaySize()
+			cfg.Display.Present(c.DisplayView(), width, height)
+		}
+	}
+	return nil
+}
+
+// ParseInput parses a key script made of whitespace or comma separated
+// events of the form <frame>:<+|-><hex key>, e.g. "30:+5 45:-5" presses
+// key 5 on frame 30 and releases it on frame 45. A # starts a comment
+// running to the end of the line
+func ParseInput(script string) ([]KeyEvent, error) {
+	var events []KeyEvent
+	scanner := bufio.NewScanner(strings.NewReader(script))
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			frame, key, ok := strings.Cut(field, ":")
+			if !ok || len(key) != 2 || (key[0] != '+' && key[0] != '-') {
+				return nil, fmt.Errorf("line %d: malformed key event %q", line, field)
+			}
+			f, err := strconv.Atoi(frame)
+			if err != nil || f < 0 {
+				return nil, fmt.Errorf("line %d: bad frame in %q", line, field)
+			}
+			k, err := strconv.ParseUint(key[1:], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad key in %q", line, field)
+			}
+			events = append(events, KeyEvent{Frame: f, Key: uint8(k), Down: key[0] == '+'})
+		}
+	}
+	return events, scanner.Err()
+}
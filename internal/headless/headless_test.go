@@ -0,0 +1,215 @@
+package headless_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"gochip8/internal/audio"
+	"gochip8/internal/chip8"
+	"gochip8/internal/headless"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// count adds 1 to V0 every other instruction
+var count = []byte{
+	0x70, 0x01, // V0 += 1
+	0x12, 0x00, // jump to 0x200
+}
+
+// waitKey waits for a key, stores it in V0 and exits
+var waitKey = []byte{
+	0xF0, 0x0A, // V0 = next key
+	0x00, 0xFD, // exit
+}
+
+func TestRunStops(t *testing.T) {
+	cases := []struct {
+		name   string
+		rom    []byte
+		cfg    headless.Config
+		v0     uint8
+		halted bool
+	}{
+		{"frames", count, headless.Config{IPF: 10, Frames: 3}, 15, false},
+		{"cycles", count, headless.Config{IPF: 10, Cycles: 7}, 4, false},
+		{"cycles over frames", count, headless.Config{IPF: 10, Frames: 1, Cycles: 25}, 13, false},
+		{"default ipf", count, headless.Config{Frames: 1}, (chip8.DefaultIPF + 1) / 2, false},
+		{"exit", waitKey, headless.Config{IPF: 10, Frames: 10, Input: []headless.KeyEvent{
+			{Frame: 4, Key: 7, Down: false},
+			{Frame: 2, Key: 7, Down: true},
+		}}, 7, true},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := headless.Run(tc.rom, tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			regs := c.GetRegisterState()
+			if regs.V[0] != tc.v0 || regs.Halted != tc.halted {
+				t.Errorf("V0 = %d, halted %v, want %d and %v", regs.V[0], regs.Halted, tc.v0, tc.halted)
+			}
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	invalid := []byte{0xE0, 0x00}
+	var opErr chip8.ErrInvalidOpcode
+	c, err := headless.Run(invalid, headless.Config{Frames: 5, ErrorPolicy: chip8.Strict})
+	if !errors.As(err, &opErr) || c.GetRegisterState().PC != chip8.StartAddr {
+		t.Errorf("strict run returned %v at PC %03X, want the invalid opcode at %03X", err, c.GetRegisterState().PC, chip8.StartAddr)
+	}
+	if _, err := headless.Run(invalid, headless.Config{Frames: 5}); err != nil {
+		t.Errorf("lenient run returned %v", err)
+	}
+	if c, err := headless.Run(make([]byte, chip8.MemoryBufferSize), headless.Config{Frames: 1}); c != nil || !errors.Is(err, chip8.ErrROMTooLarge) {
+		t.Errorf("oversize ROM returned %v, want no chip8 and %v", err, chip8.ErrROMTooLarge)
+	}
+	if c, err := headless.Run(count, headless.Config{Frames: 1, RNG: "dice"}); c != nil || err == nil {
+		t.Errorf("unknown RNG returned %v, want no chip8 and an error", err)
+	}
+}
+
+func TestRunSeed(t *testing.T) {
+	random := []byte{
+		0xC0, 0xFF, // V0 = random
+		0xC1, 0xFF, // V1 = random
+		0x00, 0xFD, // exit
+	}
+	run := func(seed int64) [16]uint8 {
+		c, err := headless.Run(random, headless.Config{Frames: 1, Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.GetRegisterState().V
+	}
+	if a, b := run(1), run(1); a != b {
+		t.Errorf("seed 1 gave %v then %v", a, b)
+	}
+	if a, b := run(1), run(2); a == b {
+		t.Errorf("seeds 1 and 2 both gave %v", a)
+	}
+}
+
+// display counts the frames presented to it
+type display struct{ frames int }
+
+func (d *display) Present(buf []uint32, width, height int) { d.frames++ }
+
+// sink counts the frames of samples written to it
+type sink struct{ writes int }
+
+func (s *sink) Write(samples []int16) error { s.writes++; return nil }
+func (s *sink) Close() error                { return nil }
+
+func TestRunBackends(t *testing.T) {
+	d, s := &display{}, &sink{}
+	_, err := headless.Run(count, headless.Config{
+		Frames:  12,
+		Display: d,
+		Audio:   audio.NewBeeper(s, audio.DefaultConfig()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.frames != 12 || s.writes != 12 {
+		t.Errorf("presented %d frames and wrote %d frames of audio, want 12 of each", d.frames, s.writes)
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	events, err := headless.ParseInput("30:+5 45:-5, 0:+a\n# comment\n60:-A # release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []headless.KeyEvent{
+		{Frame: 30, Key: 5, Down: true},
+		{Frame: 45, Key: 5, Down: false},
+		{Frame: 0, Key: 0xA, Down: true},
+		{Frame: 60, Key: 0xA, Down: false},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("ParseInput = %+v, want %+v", events, want)
+	}
+
+	for script, msg := range map[string]string{
+		"30+5":          "line 1: malformed key event",
+		"1:+5\n30:5":    "line 2: malformed key event",
+		"30:+10":        "line 1: malformed key event",
+		"x:+5":          "line 1: bad frame",
+		"-1:+5":         "line 1: bad frame",
+		"\n\n30:+g":     "line 3: bad key",
+		"30:+5 # 31:+x": "",
+	} {
+		_, err := headless.ParseInput(script)
+		if msg == "" {
+			if err != nil {
+				t.Errorf("ParseInput(%q) returned %v", script, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("ParseInput(%q) returned %v, want an error containing %q", script, err, msg)
+		}
+	}
+}
+
+// drawZero draws the digit 0 at 0, 0 and exits
+var drawZero = []byte{
+	0x60, 0x00, // V0 = 0
+	0xF0, 0x29, // I = digit V0
+	0xD0, 0x05, // draw 5 rows at V0, V0
+	0x00, 0xFD, // exit
+}
+
+func TestOutputs(t *testing.T) {
+	c, err := headless.Run(drawZero, headless.Config{Frames: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(headless.ASCII(c), "\n")
+	if len(lines) != 33 || lines[32] != "" {
+		t.Fatalf("ASCII has %d lines, want 32 ending in a newline", len(lines)-1)
+	}
+	for y, want := range []string{"####.", "#..#.", "#..#.", "#..#.", "####.", "....."} {
+		if len(lines[y]) != 64 || lines[y][:5] != want {
+			t.Errorf("line %d = %q, want 64 pixels starting %q", y, lines[y], want)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := headless.WriteRegisters(buf, c); err != nil {
+		t.Fatal(err)
+	}
+	var regs chip8.RegisterState
+	if err := json.Unmarshal(buf.Bytes(), &regs); err != nil {
+		t.Fatal(err)
+	}
+	if regs != c.GetRegisterState() || !regs.Halted {
+		t.Errorf("WriteRegisters wrote %+v, want %+v", regs, c.GetRegisterState())
+	}
+
+	buf.Reset()
+	if err := headless.WritePNG(buf, c, 2); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 128 || b.Dy() != 64 {
+		t.Errorf("PNG is %dx%d, want 128x64", b.Dx(), b.Dy())
+	}
+	if r, _, _, _ := img.At(1, 1).RGBA(); r == 0 {
+		t.Error("PNG pixel of a lit pixel is black")
+	}
+	if r, _, _, _ := img.At(2, 2).RGBA(); r != 0 {
+		t.Error("PNG pixel of an unlit pixel isn't black")
+	}
+}
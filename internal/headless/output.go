@@ -0,0 +1,38 @@
+package headless
+
+import (
+	"encoding/json"
+	"gochip8/internal/chip8"
+	"io"
+	"strings"
+)
+
+// asciiPixels maps the plane bitmask of a pixel to a character
+var asciiPixels = [4]byte{'.', '#', '+', '%'}
+
+// ASCII renders the framebuffer with one character per pixel and one line per row
+func ASCII(c *chip8.Chip8) string {
+	buf := c.GetDisplayBuffer()
+	w, h := c.GetDisplaySize()
+	sb := strings.Builder{}
+	sb.Grow((w + 1) * h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sb.WriteByte(asciiPixels[buf[y*w+x]&chip8.PlaneMask])
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// WritePNG encodes the framebuffer as a PNG, each pixel scaled to a scale x scale square
+func WritePNG(w io.Writer, c *chip8.Chip8, scale int) error {
+	return c.WriteScreenshot(w, scale, chip8.GrayPalette)
+}
+
+// WriteRegisters encodes the register state as indented JSON
+func WriteRegisters(w io.Writer, c *chip8.Chip8) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c.GetRegisterState())
+}
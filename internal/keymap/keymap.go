@@ -0,0 +1,199 @@
+// Package keymap maps physical keyboard keys onto the chip8 hex keypad.
+//
+// Keys are named as SDL names them, e.g. "Q", "1" or "Keypad 7". A keymap
+// file is JSON and may start from a built-in layout, rebind individual hex
+// keys and override both for particular ROMs, identified by the SHA-256 of
+// the ROM image:
+//
+//	{
+//	  "layout": "qwerty",
+//	  "keys": {"5": ["W", "Up"], "8": ["S", "Down"]},
+//	  "roms": {
+//	    "<sha256 hex>": {"layout": "numpad", "keys": {"F": ["Space"]}}
+//	  }
+//	}
+package keymap
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLayout is used when no keymap is given
+const DefaultLayout = "qwerty"
+
+// Keymap lists the physical keys bound to each hex key
+type Keymap [16][]string
+
+// grid builds a layout from the keys covering the four rows of the hex
+// keypad, which reads 1 2 3 C / 4 5 6 D / 7 8 9 E / A 0 B F
+func grid(rows [4][4]string) Keymap {
+	hexRows := [4][4]uint8{
+		{0x1, 0x2, 0x3, 0xC},
+		{0x4, 0x5, 0x6, 0xD},
+		{0x7, 0x8, 0x9, 0xE},
+		{0xA, 0x0, 0xB, 0xF},
+	}
+	var km Keymap
+	for r, row := range rows {
+		for c, key := range row {
+			km[hexRows[r][c]] = []string{key}
+		}
+	}
+	return km
+}
+
+// builtins are the shipped layouts. The keyboard layouts use the block of
+// keys under 1 2 3 4 wherever those keys are printed; numpad binds each
+// digit to itself and the letters to the keys around the digits
+var builtins = map[string]Keymap{
+	"qwerty": grid([4][4]string{
+		{"1", "2", "3", "4"},
+		{"Q", "W", "E", "R"},
+		{"A", "S", "D", "F"},
+		{"Z", "X", "C", "V"},
+	}),
+	"azerty": grid([4][4]string{
+		{"&", "é", "\"", "'"},
+		{"A", "Z", "E", "R"},
+		{"Q", "S", "D", "F"},
+		{"W", "X", "C", "V"},
+	}),
+	"dvorak": grid([4][4]string{
+		{"1", "2", "3", "4"},
+		{"'", ",", ".", "P"},
+		{"A", "O", "E", "U"},
+		{";", "Q", "J", "K"},
+	}),
+	"numpad": {
+		0x0: {"Keypad 0"}, 0x1: {"Keypad 1"}, 0x2: {"Keypad 2"}, 0x3: {"Keypad 3"},
+		0x4: {"Keypad 4"}, 0x5: {"Keypad 5"}, 0x6: {"Keypad 6"}, 0x7: {"Keypad 7"},
+		0x8: {"Keypad 8"}, 0x9: {"Keypad 9"}, 0xA: {"Keypad /"}, 0xB: {"Keypad *"},
+		0xC: {"Keypad -"}, 0xD: {"Keypad +"}, 0xE: {"Keypad Enter"}, 0xF: {"Keypad ."},
+	},
+}
+
+// BuiltinNames returns the names of the shipped layouts
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Builtin returns a copy of a shipped layout
+func Builtin(name string) (Keymap, error) {
+	km, ok := builtins[strings.ToLower(name)]
+	if !ok {
+		return Keymap{}, fmt.Errorf("unknown layout %q, expected one of %s", name, strings.Join(BuiltinNames(), ", "))
+	}
+	var out Keymap
+	for k, keys := range km {
+		out[k] = append([]string(nil), keys...)
+	}
+	return out, nil
+}
+
+// Bindings is a layout to start from and the hex keys to rebind on top of
+// it, each listed key replaces all the bindings of that hex key
+type Bindings struct {
+	Layout string              `json:"layout,omitempty"`
+	Keys   map[string][]string `json:"keys,omitempty"`
+}
+
+// File is the contents of a keymap file
+type File struct {
+	Bindings
+	// ROMs holds per ROM overrides keyed by the hex SHA-256 of the ROM
+	ROMs map[string]Bindings `json:"roms,omitempty"`
+}
+
+// Load reads and checks a keymap file
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := f.For([32]byte{}); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for hash, b := range f.ROMs {
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 64 {
+			return nil, fmt.Errorf("%s: %q is not a SHA-256 hex digest", path, hash)
+		}
+		if _, err := b.apply(Keymap{}); err != nil {
+			return nil, fmt.Errorf("%s: rom %s: %w", path, hash, err)
+		}
+	}
+	return f, nil
+}
+
+// For resolves the keymap for the ROM with the given hash: the file's
+// layout, then its keys, then the ROM's override if there is one
+func (f *File) For(romHash [32]byte) (Keymap, error) {
+	km, err := Builtin(DefaultLayout)
+	if err != nil {
+		return km, err
+	}
+	if km, err = f.Bindings.apply(km); err != nil {
+		return km, err
+	}
+	for hash, b := range f.ROMs {
+		if strings.EqualFold(hash, hex.EncodeToString(romHash[:])) {
+			return b.apply(km)
+		}
+	}
+	return km, nil
+}
+
+// apply lays the bindings over km
+func (b Bindings) apply(km Keymap) (Keymap, error) {
+	if b.Layout != "" {
+		var err error
+		if km, err = Builtin(b.Layout); err != nil {
+			return km, err
+		}
+	}
+	//"a" and "A" name the same hex key and map order would pick the winner
+	var seen [16]bool
+	for name, keys := range b.Keys {
+		k, err := strconv.ParseUint(name, 16, 4)
+		if err != nil {
+			return km, fmt.Errorf("%q is not a hex keypad key", name)
+		}
+		if seen[k] {
+			return km, fmt.Errorf("hex key %X is bound more than once", k)
+		}
+		seen[k] = true
+		km[k] = append([]string(nil), keys...)
+	}
+	return km, nil
+}
+
+// Resolve turns the -keymap flag into a keymap for the ROM with the given
+// hash. The flag names either a built-in layout or a keymap file, empty
+// selects the default layout
+func Resolve(spec string, romHash [32]byte) (Keymap, error) {
+	if spec == "" {
+		spec = DefaultLayout
+	}
+	if _, ok := builtins[strings.ToLower(spec)]; ok {
+		return Builtin(spec)
+	}
+	f, err := Load(spec)
+	if err != nil {
+		return Keymap{}, err
+	}
+	return f.For(romHash)
+}
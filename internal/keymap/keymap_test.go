@@ -0,0 +1,147 @@
+package keymap_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"gochip8/internal/keymap"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinLayouts(t *testing.T) {
+	names := keymap.BuiltinNames()
+	if want := []string{"azerty", "dvorak", "numpad", "qwerty"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("BuiltinNames() = %v, want %v", names, want)
+	}
+	for _, name := range names {
+		km, err := keymap.Builtin(strings.ToUpper(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bound := map[string]int{}
+		for k, keys := range km {
+			if len(keys) == 0 {
+				t.Errorf("%s leaves hex key %X unbound", name, k)
+			}
+			for _, key := range keys {
+				if prev, ok := bound[key]; ok {
+					t.Errorf("%s binds %q to both %X and %X", name, key, prev, k)
+				}
+				bound[key] = k
+			}
+		}
+	}
+
+	km, _ := keymap.Builtin("qwerty")
+	for k, want := range map[int]string{0x0: "X", 0x1: "1", 0x4: "Q", 0xC: "4", 0xE: "F", 0xF: "V"} {
+		if !reflect.DeepEqual(km[k], []string{want}) {
+			t.Errorf("qwerty binds %X to %v, want %s", k, km[k], want)
+		}
+	}
+	km[0][0] = "changed"
+	if again, _ := keymap.Builtin("qwerty"); again[0][0] != "X" {
+		t.Error("changing a returned layout changed the built-in")
+	}
+
+	if _, err := keymap.Builtin("colemak"); err == nil {
+		t.Error("unknown layout was accepted")
+	}
+}
+
+// writeFile writes a keymap file to a temporary directory and returns its path
+func writeFile(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keymap.json")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	rom := sha256.Sum256([]byte("rom"))
+	path := writeFile(t, `{
+		"layout": "dvorak",
+		"keys": {"5": ["W", "Up"], "a": ["Space"]},
+		"roms": {
+			"`+strings.ToUpper(hex.EncodeToString(rom[:]))+`": {"layout": "numpad", "keys": {"F": ["Return"]}}
+		}
+	}`)
+	f, err := keymap.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	km, err := f.For(sha256.Sum256([]byte("other rom")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(km[5], []string{"W", "Up"}) || !reflect.DeepEqual(km[0xA], []string{"Space"}) {
+		t.Errorf("rebound keys 5 and A are %v and %v", km[5], km[0xA])
+	}
+	if !reflect.DeepEqual(km[4], []string{"'"}) {
+		t.Errorf("key 4 = %v, want the dvorak binding", km[4])
+	}
+
+	km, err = f.For(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(km[0xF], []string{"Return"}) || !reflect.DeepEqual(km[5], []string{"Keypad 5"}) {
+		t.Errorf("ROM override gave keys F and 5 %v and %v, want Return and the numpad", km[0xF], km[5])
+	}
+
+	km, err = keymap.Resolve(path, rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(km[0xF], []string{"Return"}) {
+		t.Errorf("Resolve of a keymap file gave key F %v, want Return", km[0xF])
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"malformed json", `{"keys": }`, "invalid character"},
+		{"unknown layout", `{"layout": "colemak"}`, "unknown layout"},
+		{"key out of range", `{"keys": {"10": ["Space"]}}`, `"10" is not a hex keypad key`},
+		{"key not hex", `{"keys": {"G": ["Space"]}}`, `"G" is not a hex keypad key`},
+		{"key bound twice", `{"keys": {"a": ["Space"], "A": ["Return"]}}`, "hex key A is bound more than once"},
+		{"bad rom hash", `{"roms": {"abc": {}}}`, "not a SHA-256"},
+		{"bad rom key", `{"roms": {"` + strings.Repeat("0", 64) + `": {"keys": {"-1": ["Space"]}}}}`, `"-1" is not a hex keypad key`},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeFile(t, tc.src)
+			_, err := keymap.Load(path)
+			if err == nil {
+				t.Fatal("Load succeeded")
+			}
+			if !strings.Contains(err.Error(), tc.want) || !strings.Contains(err.Error(), path) {
+				t.Errorf("error %q doesn't name the file and %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	def, _ := keymap.Builtin(keymap.DefaultLayout)
+	if km, err := keymap.Resolve("", [32]byte{}); err != nil || !reflect.DeepEqual(km, def) {
+		t.Errorf("Resolve(\"\") = %v, %v, want the default layout", km, err)
+	}
+	azerty, _ := keymap.Builtin("azerty")
+	if km, err := keymap.Resolve("AZERTY", [32]byte{}); err != nil || !reflect.DeepEqual(km, azerty) {
+		t.Errorf("Resolve(\"AZERTY\") = %v, %v, want the azerty layout", km, err)
+	}
+	if _, err := keymap.Resolve(filepath.Join(t.TempDir(), "missing.json"), [32]byte{}); !os.IsNotExist(err) {
+		t.Errorf("Resolve of a missing file returned %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+// Package machine runs a chip8 against pluggable host backends: a Display
+// that shows the screen, a Keypad that supplies input and an AudioSink that
+// plays the buzzer. The SDL window is one set of backends, terminals, image
+// files, network peers or tests can provide others without touching the
+// frame loop
+package machine
+
+import (
+	"gochip8/internal/audio"
+	"gochip8/internal/chip8"
+)
+
+// Display shows the chip8 screen
+type Display interface {
+	// Present shows a width x height frame holding the lit planes of each
+	// pixel. buf belongs to the chip8 and is only valid during the call
+	Present(buf []uint32, width, height int)
+}
+
+// Keys receives the hex keypad transitions, implemented by *chip8.Chip8
+type Keys interface {
+	KeyDown(key uint8)
+	KeyUp(key uint8)
+}
+
+// Keypad is a host input backend
+type Keypad interface {
+	// Poll forwards the key transitions since the last call to keys and
+	// returns false once the host wants to stop
+	Poll(keys Keys) bool
+}
+
+// AudioSink plays the buzzer samples
+type AudioSink = audio.AudioSink
+
+// Config selects the backends of a Machine, Keypad and Audio may be nil
+type Config struct {
+	// IPF is the number of instructions executed per 60 Hz frame
+	IPF     int
+	Display Display
+	Keypad  Keypad
+	Audio   AudioSink
+	// Sound shapes the buzzer played through Audio
+	Sound audio.Config
+}
+
+// Machine drives a chip8 one 60 Hz frame at a time: it polls the keypad,
+// emulates the frame, renders the buzzer and presents the screen
+type Machine struct {
+	chip8   *chip8.Chip8
+	ipf     int
+	display Display
+	keypad  Keypad
+	beeper  *audio.Beeper
+	keys    Keys
+	step    func() error
+	muted   func() bool
+}
+
+// New creates a machine running c on the backends in cfg
+func New(c *chip8.Chip8, cfg Config) *Machine {
+	if cfg.IPF < 1 {
+		cfg.IPF = chip8.DefaultIPF
+	}
+	m := &Machine{
+		chip8:   c,
+		ipf:     cfg.IPF,
+		display: cfg.Display,
+		keypad:  cfg.Keypad,
+		keys:    c,
+	}
+	if cfg.Audio != nil {
+		m.beeper = audio.NewBeeper(cfg.Audio, cfg.Sound)
+	}
+	m.step = m.Emulate
+	return m
+}
+
+// SetKeys replaces the receiver of the keypad input, such as a movie
+// recorder wrapping the chip8. nil restores the chip8
+func (m *Machine) SetKeys(keys Keys) {
+	if keys == nil {
+		keys = m.chip8
+	}
+	m.keys = keys
+}
+
+// SetStep replaces how a frame is emulated, e.g. by a debugger or rewind.
+// nil restores Emulate
+func (m *Machine) SetStep(step func() error) {
+	if step == nil {
+		step = m.Emulate
+	}
+	m.step = step
+}
+
+// SetMuted silences the buzzer while muted returns true, for frames where
+// the timers don't run such as while paused
+func (m *Machine) SetMuted(muted func() bool) {
+	m.muted = muted
+}
+
+// Emulate runs ipf instructions and ticks the timers, the default step
+func (m *Machine) Emulate() error {
+	return m.chip8.RunFrame(m.ipf)
+}
+
+// Frame polls the keypad, runs one step and presents the result. It
+// returns false once the keypad asked to stop, along with the step's error
+func (m *Machine) Frame() (bool, error) {
+	if m.keypad != nil && !m.keypad.Poll(m.keys) {
+		return false, nil
+	}
+	err := m.step()
+	if m.beeper != nil {
+		m.beeper.Frame(m.chip8.Beeping() && (m.muted == nil || !m.muted()))
+	}
+	if m.display != nil {
+		width, height := m.chip8.GetDisplaySize()
+		m.display.Present(m.chip8.DisplayView(), width, height)
+	}
+	return true, err
+}
+
+// Run calls Frame on the 60 Hz clock until the keypad asks to stop, the ROM
+// exits or onError returns false. onError receives every error a frame
+// returns, when it is nil the first error stops the machine and is returned
+func (m *Machine) Run(onError func(error) bool) error {
+	var stopErr error
+	chip8.NewScheduler(m.chip8, m.ipf).Run(func() bool {
+		running, err := m.Frame()
+		if err != nil {
+			if onError == nil || !onError(err) {
+				stopErr = err
+				return false
+			}
+		}
+		return running
+	})
+	return stopErr
+}
+
+// Close releases the audio sink, returning the first audio error
+func (m *Machine) Close() error {
+	if m.beeper == nil {
+		return nil
+	}
+	return m.beeper.Close()
+}
@@ -0,0 +1,255 @@
+package machine_test
+
+import (
+	"errors"
+	"gochip8/internal/audio"
+	"gochip8/internal/chip8"
+	"gochip8/internal/clog"
+	"gochip8/internal/machine"
+	"testing"
+)
+
+// display keeps a copy of every frame presented to it
+type display struct {
+	frames        [][]uint32
+	width, height int
+}
+
+func (d *display) Present(buf []uint32, width, height int) {
+	d.frames = append(d.frames, append([]uint32{}, buf...))
+	d.width, d.height = width, height
+}
+
+// keypad presses the key its script lists for each poll, -1 for none, and
+// asks to stop once the script runs out
+type keypad struct {
+	script []int
+	polls  int
+}
+
+func (k *keypad) Poll(keys machine.Keys) bool {
+	if k.polls == len(k.script) {
+		return false
+	}
+	if key := k.script[k.polls]; key >= 0 {
+		keys.KeyDown(uint8(key))
+	}
+	k.polls++
+	return true
+}
+
+// keyLog records the keys pressed without passing them on
+type keyLog []uint8
+
+func (l *keyLog) KeyDown(key uint8) { *l = append(*l, key) }
+func (l *keyLog) KeyUp(key uint8)   {}
+
+// sink keeps the last frame of samples written to it
+type sink struct {
+	writes int
+	last   []int16
+	err    error
+	closed bool
+}
+
+func (s *sink) Write(samples []int16) error {
+	s.writes++
+	s.last = append(s.last[:0], samples...)
+	return s.err
+}
+
+func (s *sink) Close() error {
+	s.closed = true
+	return nil
+}
+
+// silent reports whether every sample of the last frame is zero
+func (s *sink) silent() bool {
+	for _, v := range s.last {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForFive waits for key 5 then draws the digit 5 at 0, 0 and exits
+var waitForFive = []byte{
+	0x60, 0x05, // V0 = 5
+	0xE0, 0x9E, // skip if key V0 is down
+	0x12, 0x02, // jump to 0x202
+	0xF0, 0x29, // I = digit V0
+	0x61, 0x00, // V1 = 0
+	0xD1, 0x15, // draw 5 rows at V1, V1
+	0x00, 0xFD, // exit
+}
+
+// newChip8 returns a silent chip8 with rom loaded
+func newChip8(t *testing.T, rom []byte) *chip8.Chip8 {
+	t.Helper()
+	c := chip8.Init(chip8.QuirksCOSMACVIP)
+	c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+	if err := c.Load(rom); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// frame runs one frame of m and fails the test on an error
+func frame(t *testing.T, m *machine.Machine) bool {
+	t.Helper()
+	running, err := m.Frame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return running
+}
+
+func TestFramePollsAndPresents(t *testing.T) {
+	c := newChip8(t, waitForFive)
+	d := &display{}
+	k := &keypad{script: []int{-1, -1, 5}}
+	m := machine.New(c, machine.Config{IPF: 10, Display: d, Keypad: k})
+
+	for i := 0; i < 3; i++ {
+		if !frame(t, m) {
+			t.Fatalf("frame %d stopped", i)
+		}
+		if c.Halted() != (i == 2) {
+			t.Fatalf("halted %v after frame %d", c.Halted(), i)
+		}
+	}
+	if len(d.frames) != 3 || d.width != 64 || d.height != 32 {
+		t.Fatalf("presented %d %dx%d frames, want 3 64x32", len(d.frames), d.width, d.height)
+	}
+	for x, want := range []uint32{1, 1, 1, 1, 0} {
+		if d.frames[1][x] != 0 || d.frames[2][x] != want {
+			t.Errorf("pixel %d, 0 is %d before the key and %d after, want 0 and %d", x, d.frames[1][x], d.frames[2][x], want)
+		}
+	}
+
+	if frame(t, m) {
+		t.Error("frame kept running once the keypad asked to stop")
+	}
+	if len(d.frames) != 3 {
+		t.Error("a frame was presented after the keypad asked to stop")
+	}
+}
+
+func TestSetKeys(t *testing.T) {
+	c := newChip8(t, waitForFive)
+	var log keyLog
+	m := machine.New(c, machine.Config{IPF: 10, Keypad: &keypad{script: []int{5, 5}}})
+	m.SetKeys(&log)
+	frame(t, m)
+	if len(log) != 1 || log[0] != 5 || c.Halted() {
+		t.Fatalf("keys %v reached the chip8 %v, want them only in the log", log, c.Halted())
+	}
+	m.SetKeys(nil)
+	frame(t, m)
+	if len(log) != 1 || !c.Halted() {
+		t.Errorf("keys %v reached the chip8 %v once restored, want only the chip8", log, c.Halted())
+	}
+}
+
+func TestFrameBuzzer(t *testing.T) {
+	c := newChip8(t, []byte{
+		0x60, 0xFF, // V0 = 0xFF
+		0xF0, 0x18, // sound timer = V0
+		0x12, 0x04, // jump to 0x204
+	})
+	s := &sink{}
+	m := machine.New(c, machine.Config{IPF: 10, Audio: s, Sound: audio.DefaultConfig()})
+	for i := 0; i < 3; i++ {
+		frame(t, m)
+	}
+	if s.writes != 3 || s.silent() {
+		t.Errorf("%d frames written, last silent %v, want 3 sounding", s.writes, s.silent())
+	}
+
+	muted := true
+	m.SetMuted(func() bool { return muted })
+	for i := 0; i < 3; i++ {
+		frame(t, m)
+	}
+	if s.writes != 6 || !s.silent() {
+		t.Errorf("%d frames written, last silent %v, want 6 ending silent", s.writes, s.silent())
+	}
+	muted = false
+	frame(t, m)
+	if s.silent() {
+		t.Error("buzzer stayed silent once unmuted")
+	}
+
+	s.err = errors.New("device lost")
+	frame(t, m)
+	if err := m.Close(); err != s.err || !s.closed {
+		t.Errorf("Close returned %v and closed the sink %v, want %v and true", err, s.closed, s.err)
+	}
+}
+
+func TestCloseWithoutAudio(t *testing.T) {
+	m := machine.New(newChip8(t, waitForFive), machine.Config{})
+	if err := m.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetStep(t *testing.T) {
+	c := newChip8(t, waitForFive)
+	d := &display{}
+	m := machine.New(c, machine.Config{Display: d})
+	errStep := errors.New("step")
+	steps := 0
+	m.SetStep(func() error {
+		steps++
+		return errStep
+	})
+	if running, err := m.Frame(); !running || err != errStep {
+		t.Errorf("Frame returned %v, %v, want true and the step's error", running, err)
+	}
+	if steps != 1 || c.GetRegisterState().PC != chip8.StartAddr || len(d.frames) != 1 {
+		t.Errorf("%d steps ran, PC %03X, %d frames presented, want 1 step, no emulation and 1 frame",
+			steps, c.GetRegisterState().PC, len(d.frames))
+	}
+	m.SetStep(nil)
+	frame(t, m)
+	if steps != 1 || c.GetRegisterState().PC == chip8.StartAddr {
+		t.Error("SetStep(nil) didn't restore emulation")
+	}
+}
+
+func TestRun(t *testing.T) {
+	d := &display{}
+	m := machine.New(newChip8(t, []byte{0x00, 0xFD}), machine.Config{Display: d})
+	if err := m.Run(nil); err != nil || len(d.frames) != 1 {
+		t.Errorf("Run returned %v after %d frames, want nil after 1 when the ROM exits", err, len(d.frames))
+	}
+
+	m = machine.New(newChip8(t, waitForFive), machine.Config{Keypad: &keypad{script: []int{-1, -1}}})
+	if err := m.Run(nil); err != nil {
+		t.Errorf("Run returned %v when the keypad asked to stop", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	newMachine := func() *machine.Machine {
+		c := newChip8(t, []byte{0xE0, 0x00})
+		c.SetErrorPolicy(chip8.Strict)
+		return machine.New(c, machine.Config{})
+	}
+	var invalid chip8.ErrInvalidOpcode
+
+	if err := newMachine().Run(nil); !errors.As(err, &invalid) {
+		t.Errorf("Run returned %v, want the invalid opcode", err)
+	}
+
+	calls := 0
+	err := newMachine().Run(func(err error) bool {
+		calls++
+		return calls < 3
+	})
+	if !errors.As(err, &invalid) || calls != 3 {
+		t.Errorf("Run returned %v after %d calls to onError, want the invalid opcode after 3", err, calls)
+	}
+}
@@ -0,0 +1,237 @@
+// Package movie records keypad input into a file that replays a session
+// exactly. A movie holds everything a run depends on besides the ROM: the
+// quirks, the error policy, the random seed and generator, the instructions
+// per frame and every key transition with the frame and cycle it happened on
+package movie
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gochip8/internal/chip8"
+	"io"
+	"os"
+)
+
+// Version is the movie format written by this package
+const Version = 1
+
+var (
+	ErrROMMismatch = errors.New("movie: recorded with a different ROM")
+	ErrDesync      = errors.New("movie: replay desynchronised")
+)
+
+// Event is a key transition applied at the start of Frame, after Cycle
+// instructions had run since the machine was reset
+type Event struct {
+	Frame int64 `json:"frame"`
+	Cycle int64 `json:"cycle"`
+	Key   uint8 `json:"key"`
+	Down  bool  `json:"down"`
+}
+
+// Movie is a recorded session
+type Movie struct {
+	Version int    `json:"version"`
+	ROMHash string `json:"rom_sha256"`
+	// Profile is the name of the quirks profile, Quirks the quirks themselves
+	Profile string       `json:"quirks_profile"`
+	Quirks  chip8.Quirks `json:"quirks"`
+	Seed    int64        `json:"seed"`
+	// RNG names the built-in random number generator, empty for the default
+	RNG string `json:"rng,omitempty"`
+	// Strict is set when faults stopped the chip8, a lenient chip8 carries
+	// on past them and runs differently from there
+	Strict bool `json:"strict,omitempty"`
+	IPF    int  `json:"ipf"`
+	// Frames is the length of the session
+	Frames int64   `json:"frames"`
+	Events []Event `json:"events"`
+}
+
+// Write encodes the movie as JSON
+func (m *Movie) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// Save writes the movie to a file
+func (m *Movie) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := m.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read decodes a movie
+func Read(r io.Reader) (*Movie, error) {
+	m := &Movie{}
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, err
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("movie: unsupported version %d", m.Version)
+	}
+	return m, nil
+}
+
+// Load reads a movie from a file
+func Load(path string) (*Movie, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// MatchesROM reports whether the movie was recorded with rom
+func (m *Movie) MatchesROM(rom []byte) bool {
+	hash := sha256.Sum256(rom)
+	return m.ROMHash == hex.EncodeToString(hash[:])
+}
+
+// ErrorPolicy returns the error policy the movie was recorded with
+func (m *Movie) ErrorPolicy() chip8.ErrorPolicy {
+	if m.Strict {
+		return chip8.Strict
+	}
+	return chip8.Lenient
+}
+
+// Setup seeds c and sets its error policy from the movie after checking it
+// was recorded with the ROM c has loaded. The chip8 must have been created
+// with m.Quirks
+func (m *Movie) Setup(c *chip8.Chip8) error {
+	hash := c.ROMHash()
+	if m.ROMHash != hex.EncodeToString(hash[:]) {
+		return ErrROMMismatch
+	}
+	rng := m.RNG
+	if rng == "" {
+		rng = chip8.DefaultRNG
+	}
+	if err := c.SelectRNG(rng); err != nil {
+		return err
+	}
+	c.SetSeed(m.Seed)
+	c.SetErrorPolicy(m.ErrorPolicy())
+	return nil
+}
+
+// Recorder forwards keypad input to a chip8 and records it
+type Recorder struct {
+	c     *chip8.Chip8
+	movie *Movie
+}
+
+// NewRecorder starts recording a session on c, which should be freshly
+// loaded. The chip8's seed, RNG and error policy are recorded and it is
+// reseeded so the sequence starts from the beginning
+func NewRecorder(c *chip8.Chip8, profile string, quirks chip8.Quirks, ipf int) *Recorder {
+	hash := c.ROMHash()
+	seed, rng := c.Seed(), c.RNGName()
+	if rng == chip8.DefaultRNG {
+		rng = ""
+	}
+	c.SetSeed(seed)
+	return &Recorder{c: c, movie: &Movie{
+		Version: Version,
+		ROMHash: hex.EncodeToString(hash[:]),
+		Profile: profile,
+		Quirks:  quirks,
+		Seed:    seed,
+		RNG:     rng,
+		Strict:  c.ErrorPolicy() == chip8.Strict,
+		IPF:     ipf,
+	}}
+}
+
+func (r *Recorder) record(key uint8, down bool) {
+	if r.c.Keys()[key&0xF] == down {
+		return
+	}
+	r.movie.Events = append(r.movie.Events, Event{
+		Frame: r.movie.Frames,
+		Cycle: r.c.GetRegisterState().Ticks,
+		Key:   key & 0xF,
+		Down:  down,
+	})
+}
+
+// KeyDown records and presses a key
+func (r *Recorder) KeyDown(key uint8) {
+	r.record(key, true)
+	r.c.KeyDown(key)
+}
+
+// KeyUp records and releases a key
+func (r *Recorder) KeyUp(key uint8) {
+	r.record(key, false)
+	r.c.KeyUp(key)
+}
+
+// EndFrame advances the frame counter, call it after every frame
+func (r *Recorder) EndFrame() {
+	r.movie.Frames++
+}
+
+// Movie returns the session recorded so far
+func (r *Recorder) Movie() *Movie {
+	return r.movie
+}
+
+// Player feeds a movie's input back into a chip8
+type Player struct {
+	c     *chip8.Chip8
+	movie *Movie
+	frame int64
+	next  int
+}
+
+// NewPlayer prepares c, created with m.Quirks and with the ROM loaded, to
+// replay m
+func NewPlayer(c *chip8.Chip8, m *Movie) (*Player, error) {
+	if err := m.Setup(c); err != nil {
+		return nil, err
+	}
+	return &Player{c: c, movie: m}, nil
+}
+
+// Done reports whether every recorded frame has been replayed
+func (p *Player) Done() bool {
+	return p.frame >= p.movie.Frames
+}
+
+// RunFrame applies the input recorded for the next frame and runs it. It
+// returns ErrDesync if the machine reached the frame after a different
+// number of cycles than when it was recorded, or the fault that stopped a
+// strict chip8
+func (p *Player) RunFrame() error {
+	events := p.movie.Events
+	for p.next < len(events) && events[p.next].Frame <= p.frame {
+		ev := events[p.next]
+		if ev.Cycle != p.c.GetRegisterState().Ticks {
+			return fmt.Errorf("%w: frame %d was recorded at cycle %d, replayed at %d", ErrDesync, ev.Frame, ev.Cycle, p.c.GetRegisterState().Ticks)
+		}
+		if ev.Down {
+			p.c.KeyDown(ev.Key)
+		} else {
+			p.c.KeyUp(ev.Key)
+		}
+		p.next++
+	}
+	if err := p.c.RunFrame(p.movie.IPF); err != nil {
+		return err
+	}
+	p.frame++
+	return nil
+}
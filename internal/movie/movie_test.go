@@ -0,0 +1,139 @@
+package movie_test
+
+import (
+	"bytes"
+	"errors"
+	"gochip8/internal/chip8"
+	"gochip8/internal/clog"
+	"gochip8/internal/movie"
+	"reflect"
+	"testing"
+)
+
+// rom draws a pixel at a random position every cycle and counts in V3 the
+// cycles key 5 is held, so both CXNN and the keypad steer the run
+var rom = []byte{
+	0xA2, 0x12, // I = 0x212
+	0xC0, 0x3F, // V0 = random & 0x3F
+	0xC1, 0x1F, // V1 = random & 0x1F
+	0xD0, 0x11, // draw 1 row at V0, V1
+	0x64, 0x05, // V4 = 5
+	0xE4, 0xA1, // skip if key V4 is up
+	0x73, 0x01, // V3 += 1
+	0x12, 0x02, // jump to 0x202
+	0x00, 0x00,
+	0x80, // the pixel
+}
+
+const ipf = 7
+
+// newChip8 returns a silent chip8 with rom loaded
+func newChip8(t *testing.T, rom []byte) *chip8.Chip8 {
+	t.Helper()
+	c := chip8.Init(chip8.QuirksCOSMACVIP)
+	c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+	c.Load(rom)
+	return c
+}
+
+// record runs 60 frames of rom, holding key 5 through frames 10 to 29,
+// and returns the movie read back from its JSON along with the chip8
+func record(t *testing.T, policy chip8.ErrorPolicy) (*movie.Movie, *chip8.Chip8) {
+	t.Helper()
+	c := newChip8(t, rom)
+	c.SetSeed(42)
+	c.SetErrorPolicy(policy)
+	r := movie.NewRecorder(c, "vip", chip8.QuirksCOSMACVIP, ipf)
+	for frame := 0; frame < 60; frame++ {
+		switch frame {
+		case 10:
+			r.KeyDown(5)
+		case 30:
+			r.KeyUp(5)
+		}
+		if err := c.RunFrame(ipf); err != nil {
+			t.Fatal(err)
+		}
+		r.EndFrame()
+	}
+	buf := &bytes.Buffer{}
+	if err := r.Movie().Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	m, err := movie.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, c
+}
+
+// replay plays m back on a fresh chip8 seeded differently from the recording
+func replay(t *testing.T, m *movie.Movie) (*chip8.Chip8, error) {
+	t.Helper()
+	c := newChip8(t, rom)
+	c.SetSeed(7)
+	p, err := movie.NewPlayer(c, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for !p.Done() {
+		if err := p.RunFrame(); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+func TestReplayMatchesRecording(t *testing.T) {
+	m, recorded := record(t, chip8.Lenient)
+	if len(m.Events) != 2 {
+		t.Fatalf("recorded %d events, want 2", len(m.Events))
+	}
+	replayed, err := replay(t, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, got := recorded.GetRegisterState(), replayed.GetRegisterState()
+	if got != want {
+		t.Errorf("replayed registers %+v, want %+v", got, want)
+	}
+	if want.V[3] == 0 {
+		t.Error("the key was never seen held")
+	}
+	if !reflect.DeepEqual(replayed.GetDisplayBuffer(), recorded.GetDisplayBuffer()) {
+		t.Error("replayed display differs from the recording")
+	}
+}
+
+func TestReplayDetectsDesync(t *testing.T) {
+	m, _ := record(t, chip8.Lenient)
+	m.Events[0].Cycle++
+	if _, err := replay(t, m); !errors.Is(err, movie.ErrDesync) {
+		t.Errorf("replay returned %v, want %v", err, movie.ErrDesync)
+	}
+}
+
+func TestPlayerRefusesOtherROM(t *testing.T) {
+	m, _ := record(t, chip8.Lenient)
+	other := append([]byte{}, rom...)
+	other[len(other)-1] = 0xC0
+	if _, err := movie.NewPlayer(newChip8(t, other), m); !errors.Is(err, movie.ErrROMMismatch) {
+		t.Errorf("NewPlayer returned %v, want %v", err, movie.ErrROMMismatch)
+	}
+}
+
+func TestReplayUsesRecordedErrorPolicy(t *testing.T) {
+	for _, policy := range []chip8.ErrorPolicy{chip8.Lenient, chip8.Strict} {
+		m, _ := record(t, policy)
+		c := newChip8(t, rom)
+		if policy == chip8.Lenient {
+			c.SetErrorPolicy(chip8.Strict)
+		}
+		if _, err := movie.NewPlayer(c, m); err != nil {
+			t.Fatal(err)
+		}
+		if c.ErrorPolicy() != policy {
+			t.Errorf("replaying a movie recorded with policy %d set policy %d", policy, c.ErrorPolicy())
+		}
+	}
+}
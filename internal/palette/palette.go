@@ -0,0 +1,183 @@
+// Package palette colours the chip8 display. The core stores each pixel as
+// the bitmask of the XO-CHIP planes lighting it, a Palette maps the four
+// possible values to colours.
+//
+// A palette is picked by theme name, by listing its colours in hex, e.g.
+// "#000000,#33FF33", or from a JSON file that starts from a theme and
+// replaces some of its colours, keyed by plane bitmask:
+//
+//	{"theme": "octo", "colors": {"0": "#000000", "3": "#FFFFFF"}}
+//
+// Two colours give the background and the first plane, the second plane
+// and the blend of both are shaded between them
+package palette
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultTheme is used when no palette is given
+const DefaultTheme = "classic"
+
+// Palette holds the 0xRRGGBB colour of each plane bitmask: background,
+// first plane, second plane, and both planes
+type Palette [4]uint32
+
+// builtins are the shipped themes
+var builtins = map[string]Palette{
+	"classic": {0x000000, 0xFFFFFF, 0xAAAAAA, 0x555555},
+	"amber":   {0x140C00, 0xFFB000, 0xB87A00, 0x6B4600},
+	"green":   {0x001400, 0x33FF66, 0x22AA44, 0x115522},
+	// the four greens of the original Game Boy screen
+	"lcd": {0x9BBC0F, 0x0F380F, 0x306230, 0x8BAC0F},
+	// the background, fill, second fill and blend colours Octo starts with
+	"octo": {0x996600, 0xFFCC00, 0xFF6600, 0x662200},
+}
+
+// Names returns the names of the shipped themes
+func Names() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Default returns the default theme
+func Default() Palette {
+	return builtins[DefaultTheme]
+}
+
+// Builtin returns a shipped theme
+func Builtin(name string) (Palette, error) {
+	p, ok := builtins[strings.ToLower(name)]
+	if !ok {
+		return Palette{}, fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(Names(), ", "))
+	}
+	return p, nil
+}
+
+// parseColor parses an RRGGBB hex colour, with or without a leading #
+func parseColor(s string) (uint32, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) != 6 {
+		return 0, fmt.Errorf("%q is not an RRGGBB hex colour", s)
+	}
+	c, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an RRGGBB hex colour", s)
+	}
+	return uint32(c), nil
+}
+
+// mix returns the colour a fraction num/den of the way from a to b
+func mix(a, b uint32, num, den int) uint32 {
+	var c uint32
+	for shift := 0; shift <= 16; shift += 8 {
+		ca, cb := int(a>>shift&0xFF), int(b>>shift&0xFF)
+		c |= uint32(ca+(cb-ca)*num/den) << shift
+	}
+	return c
+}
+
+// ParseColors builds a palette from 2 or 4 comma separated hex colours
+func ParseColors(list string) (Palette, error) {
+	fields := strings.Split(list, ",")
+	if len(fields) != 2 && len(fields) != 4 {
+		return Palette{}, fmt.Errorf("%q lists %d colours, want 2 or 4", list, len(fields))
+	}
+	var p Palette
+	for i, field := range fields {
+		c, err := parseColor(field)
+		if err != nil {
+			return Palette{}, err
+		}
+		p[i] = c
+	}
+	if len(fields) == 2 {
+		p[2], p[3] = mix(p[0], p[1], 2, 3), mix(p[0], p[1], 1, 3)
+	}
+	return p, nil
+}
+
+// File is the contents of a palette file
+type File struct {
+	Theme  string            `json:"theme,omitempty"`
+	Colors map[string]string `json:"colors,omitempty"`
+}
+
+// Load reads a palette file
+func Load(path string) (Palette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Palette{}, err
+	}
+	f := File{}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Palette{}, fmt.Errorf("%s: %w", path, err)
+	}
+	p, err := f.palette()
+	if err != nil {
+		return p, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// palette lays the file's colours over its theme
+func (f File) palette() (Palette, error) {
+	p := Default()
+	if f.Theme != "" {
+		var err error
+		if p, err = Builtin(f.Theme); err != nil {
+			return p, err
+		}
+	}
+	for plane, hex := range f.Colors {
+		i, err := strconv.ParseUint(plane, 10, 2)
+		if err != nil {
+			return p, fmt.Errorf("%q is not a plane bitmask from 0 to 3", plane)
+		}
+		if p[i], err = parseColor(hex); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// Resolve turns the -palette flag into a palette. The flag names a theme,
+// lists hex colours or names a palette file, empty selects the default
+// theme
+func Resolve(spec string) (Palette, error) {
+	switch {
+	case spec == "":
+		return Default(), nil
+	case strings.Contains(spec, ","):
+		return ParseColors(spec)
+	}
+	if _, ok := builtins[strings.ToLower(spec)]; ok {
+		return Builtin(spec)
+	}
+	p, err := Load(spec)
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, fmt.Errorf("%q is neither a theme, one of %s, nor a palette file", spec, strings.Join(Names(), ", "))
+	}
+	return p, err
+}
+
+// Colors returns the palette as opaque colours, for encoding images
+func (p Palette) Colors() color.Palette {
+	colors := make(color.Palette, len(p))
+	for i, c := range p {
+		colors[i] = color.NRGBA{R: uint8(c >> 16), G: uint8(c >> 8), B: uint8(c), A: 0xFF}
+	}
+	return colors
+}
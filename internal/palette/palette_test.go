@@ -0,0 +1,153 @@
+package palette_test
+
+import (
+	"gochip8/internal/palette"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseColors(t *testing.T) {
+	cases := []struct {
+		list string
+		want palette.Palette
+	}{
+		{"#000000,#FFFFFF", palette.Palette{0x000000, 0xFFFFFF, 0xAAAAAA, 0x555555}},
+		{"102030, #ab00ff", palette.Palette{0x102030, 0xAB00FF, 0x770BBA, 0x431675}},
+		{"#010203,#040506,#070809,#0A0B0C", palette.Palette{0x010203, 0x040506, 0x070809, 0x0A0B0C}},
+	}
+	for _, tc := range cases {
+		p, err := palette.ParseColors(tc.list)
+		if err != nil {
+			t.Errorf("ParseColors(%q): %v", tc.list, err)
+			continue
+		}
+		if p != tc.want {
+			t.Errorf("ParseColors(%q) = %06X, want %06X", tc.list, p, tc.want)
+		}
+	}
+}
+
+func TestParseColorsErrors(t *testing.T) {
+	cases := []struct {
+		list string
+		want string
+	}{
+		{"#000000", "lists 1 colours"},
+		{"#000000,#111111,#222222", "lists 3 colours"},
+		{"#000000,#FFF", `"#FFF" is not an RRGGBB hex colour`},
+		{"#000000,#GG0000", `"#GG0000" is not an RRGGBB hex colour`},
+		{"#000000,-00001", `"-00001" is not an RRGGBB hex colour`},
+		{"#000000,", `"" is not an RRGGBB hex colour`},
+	}
+	for _, tc := range cases {
+		_, err := palette.ParseColors(tc.list)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("ParseColors(%q) returned %v, want an error mentioning %q", tc.list, err, tc.want)
+		}
+	}
+}
+
+// writeFile writes a palette file to a temporary directory and returns its path
+func writeFile(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "palette.json")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	p, err := palette.Load(writeFile(t, `{"theme": "OCTO", "colors": {"0": "#000000", "3": "ffffff"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	octo, _ := palette.Builtin("octo")
+	if want := (palette.Palette{0x000000, octo[1], octo[2], 0xFFFFFF}); p != want {
+		t.Errorf("Load = %06X, want %06X", p, want)
+	}
+
+	p, err = palette.Load(writeFile(t, `{"colors": {"1": "#33FF33"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := palette.Default(); p[0] != want[0] || p[1] != 0x33FF33 {
+		t.Errorf("Load without a theme = %06X, want the default with plane 1 #33FF33", p)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"malformed json", `{"colors": }`, "invalid character"},
+		{"unknown theme", `{"theme": "neon"}`, "unknown theme"},
+		{"plane out of range", `{"colors": {"4": "#000000"}}`, `"4" is not a plane bitmask`},
+		{"plane not a number", `{"colors": {"bg": "#000000"}}`, `"bg" is not a plane bitmask`},
+		{"bad colour", `{"colors": {"0": "black"}}`, `"black" is not an RRGGBB hex colour`},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeFile(t, tc.src)
+			_, err := palette.Load(path)
+			if err == nil {
+				t.Fatal("Load succeeded")
+			}
+			if !strings.Contains(err.Error(), tc.want) || !strings.Contains(err.Error(), path) {
+				t.Errorf("error %q doesn't name the file and %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	amber, _ := palette.Builtin("amber")
+	file := writeFile(t, `{"theme": "amber", "colors": {"2": "#123456"}}`)
+	fromFile := amber
+	fromFile[2] = 0x123456
+	cases := []struct {
+		spec string
+		want palette.Palette
+	}{
+		{"", palette.Default()},
+		{"Amber", amber},
+		{"#000000,#FFFFFF", palette.Palette{0x000000, 0xFFFFFF, 0xAAAAAA, 0x555555}},
+		{file, fromFile},
+	}
+	for _, tc := range cases {
+		p, err := palette.Resolve(tc.spec)
+		if err != nil {
+			t.Errorf("Resolve(%q): %v", tc.spec, err)
+			continue
+		}
+		if p != tc.want {
+			t.Errorf("Resolve(%q) = %06X, want %06X", tc.spec, p, tc.want)
+		}
+	}
+
+	_, err := palette.Resolve("neon")
+	if err == nil || !strings.Contains(err.Error(), "neither a theme") {
+		t.Errorf("Resolve of an unknown name returned %v", err)
+	}
+}
+
+func TestColors(t *testing.T) {
+	colors := palette.Palette{0x000000, 0xFF8000, 0x00FF00, 0x0000FF}.Colors()
+	want := color.Palette{
+		color.NRGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xFF},
+		color.NRGBA{R: 0xFF, G: 0x80, B: 0x00, A: 0xFF},
+		color.NRGBA{R: 0x00, G: 0xFF, B: 0x00, A: 0xFF},
+		color.NRGBA{R: 0x00, G: 0x00, B: 0xFF, A: 0xFF},
+	}
+	for i := range want {
+		if colors[i] != want[i] {
+			t.Errorf("colour %d = %v, want %v", i, colors[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package term
+
+import (
+	"fmt"
+	"gochip8/internal/keymap"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// namedKeys are the byte sequences terminals send for the keys keymaps
+// name, arrows come in both the normal and application cursor forms
+var namedKeys = map[string][]string{
+	"space":        {" "},
+	"return":       {"\r", "\n"},
+	"keypad enter": {"\r", "\n"},
+	"tab":          {"\t"},
+	"up":           {"\x1b[A", "\x1bOA"},
+	"down":         {"\x1b[B", "\x1bOB"},
+	"right":        {"\x1b[C", "\x1bOC"},
+	"left":         {"\x1b[D", "\x1bOD"},
+}
+
+// keySequences returns what the terminal sends for the key named as SDL
+// names it. Keypad keys send the same characters as the main keys and
+// letters are matched in both cases
+func keySequences(name string) []string {
+	if seqs, ok := namedKeys[strings.ToLower(name)]; ok {
+		return seqs
+	}
+	name = strings.TrimPrefix(name, "Keypad ")
+	if utf8.RuneCountInString(name) != 1 {
+		return nil
+	}
+	r, _ := utf8.DecodeRuneInString(name)
+	lower, upper := string(unicode.ToLower(r)), string(unicode.ToUpper(r))
+	if lower == upper {
+		return []string{lower}
+	}
+	return []string{lower, upper}
+}
+
+// SetKeymap binds the keys named in km to the hex keypad
+func (t *Terminal) SetKeymap(km keymap.Keymap) error {
+	keys := map[string][]uint8{}
+	for k, names := range km {
+		for _, name := range names {
+			seqs := keySequences(name)
+			if seqs == nil {
+				return fmt.Errorf("key %q bound to %X can't be read from a terminal", name, k)
+			}
+			for _, seq := range seqs {
+				keys[seq] = append(keys[seq], uint8(k))
+			}
+		}
+	}
+	t.keys = keys
+	return nil
+}
+
+// splitKeys splits the bytes read from the terminal into the sequences of
+// single key presses: escape sequences, control bytes and UTF-8 characters.
+// An escape sequence or character cut off at the end of data is returned
+// as rest, to be completed by the next read. An escape followed by
+// anything but [ or O is the escape key
+func splitKeys(data []byte) (seqs []string, rest []byte) {
+	for len(data) > 0 {
+		n := 1
+		switch {
+		case data[0] == 0x1b:
+			n = escapeLen(data)
+		case data[0] >= utf8.RuneSelf && !utf8.FullRune(data):
+			n = 0
+		case data[0] >= utf8.RuneSelf:
+			_, n = utf8.DecodeRune(data)
+		}
+		if n == 0 {
+			return seqs, data
+		}
+		seqs = append(seqs, string(data[:n]))
+		data = data[n:]
+	}
+	return seqs, nil
+}
+
+// escapeLen returns the length of the escape sequence data starts with, 0
+// when data ends before it does
+func escapeLen(data []byte) int {
+	if len(data) < 2 {
+		return 0
+	}
+	switch data[1] {
+	case 'O':
+		if len(data) < 3 {
+			return 0
+		}
+		return 3
+	case '[':
+		//CSI parameters run up to a final byte in @ to ~
+		for n := 2; n < len(data); n++ {
+			if data[n] >= 0x40 && data[n] <= 0x7E {
+				return n + 1
+			}
+		}
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package term
+
+import "errors"
+
+// makeRaw isn't implemented for this platform
+func makeRaw(fd uintptr) (func() error, error) {
+	return nil, errors.New("raw terminal input is not supported on this platform")
+}
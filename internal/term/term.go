@@ -0,0 +1,374 @@
+// Package term runs the chip8 in a text terminal. The screen is drawn with
+// Unicode half blocks or braille dots in 24-bit colour, only redrawing the
+// cells that changed, and the keypad is read from stdin in raw mode.
+//
+// Terminals only report key presses, so a key is held from its first press
+// until its auto-repeat stops: a press holds it for FirstHold, long enough
+// for the terminal to start repeating, and every repeat extends the hold by
+// RepeatHold
+package term
+
+import (
+	"bufio"
+	"fmt"
+	"gochip8/internal/machine"
+	"gochip8/internal/palette"
+	"io"
+	"os"
+	"time"
+)
+
+// Mode selects the characters pixels are drawn with
+type Mode int
+
+const (
+	// HalfBlock draws each cell as two pixels stacked with ▀, coloured
+	// with the foreground and background colours
+	HalfBlock Mode = iota
+	// Braille draws each cell as a 2x4 block of braille dots, four times
+	// denser than HalfBlock but with a single colour per cell
+	Braille
+)
+
+const (
+	DefaultFirstHold  = 500 * time.Millisecond
+	DefaultRepeatHold = 100 * time.Millisecond
+)
+
+// escapeTimeout is how long an unfinished escape sequence waits for the
+// rest of its bytes, a lone escape still unfinished by then is the escape
+// key
+const escapeTimeout = 50 * time.Millisecond
+
+// ParseMode returns the mode named "halfblock" or "braille"
+func ParseMode(name string) (Mode, error) {
+	switch name {
+	case "halfblock":
+		return HalfBlock, nil
+	case "braille":
+		return Braille, nil
+	}
+	return 0, fmt.Errorf("unknown terminal mode %q, want halfblock or braille", name)
+}
+
+// cellSize returns the pixels covered by one character cell
+func (m Mode) cellSize() (int, int) {
+	if m == Braille {
+		return 2, 4
+	}
+	return 1, 2
+}
+
+// Config sets up a Terminal, zero holds use the defaults
+type Config struct {
+	Mode       Mode
+	FirstHold  time.Duration
+	RepeatHold time.Duration
+}
+
+// cell is a drawn character with its colours
+type cell struct {
+	char   rune
+	fg, bg uint32
+}
+
+// Terminal is a machine Display and Keypad drawing to a terminal
+type Terminal struct {
+	out     *bufio.Writer
+	input   chan []byte
+	restore func() error
+	cfg     Config
+	palette palette.Palette
+	// cells holds what is on screen for a width x height frame, drawn is
+	// false when the screen must be redrawn in full
+	cells         []cell
+	width, height int
+	drawn         bool
+	status        string
+	shownStatus   string
+	fault         error
+	waitingForKey bool
+	keys          map[string][]uint8
+	// pending holds the start of a key sequence split across reads and
+	// pendingSince when it arrived
+	pending      []byte
+	pendingSince time.Time
+	held         [16]hold
+	rewind       hold
+	now          func() time.Time
+}
+
+// hold tracks a key emulated as held until its deadline
+type hold struct {
+	down  bool
+	until time.Time
+}
+
+// Open switches the terminal on stdin to raw mode and starts drawing to
+// stdout. Close must be called to restore the terminal
+func Open(cfg Config) (*Terminal, error) {
+	restore, err := makeRaw(os.Stdin.Fd())
+	if err != nil {
+		return nil, fmt.Errorf("stdin is not a terminal: %w", err)
+	}
+	t := New(os.Stdin, os.Stdout, cfg)
+	t.restore = restore
+	return t, nil
+}
+
+// New creates a terminal reading keys from in and drawing to out, which
+// must already be set up as a raw terminal
+func New(in io.Reader, out io.Writer, cfg Config) *Terminal {
+	if cfg.FirstHold <= 0 {
+		cfg.FirstHold = DefaultFirstHold
+	}
+	if cfg.RepeatHold <= 0 {
+		cfg.RepeatHold = DefaultRepeatHold
+	}
+	t := &Terminal{
+		out:     bufio.NewWriterSize(out, 64*1024),
+		input:   make(chan []byte, 64),
+		cfg:     cfg,
+		palette: palette.Default(),
+		keys:    map[string][]uint8{},
+		now:     time.Now,
+	}
+	go t.read(in)
+	//hide the cursor and clear the screen
+	t.out.WriteString("\x1b[?25l\x1b[2J")
+	t.out.Flush()
+	return t
+}
+
+// read forwards the bytes arriving on in to the input channel, closing it
+// once in fails
+func (t *Terminal) read(in io.Reader) {
+	defer close(t.input)
+	buf := make([]byte, 256)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			t.input <- append([]byte{}, buf[:n]...)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Close shows the cursor again below the screen and restores the terminal
+func (t *Terminal) Close() error {
+	_, rows := t.cellsSize()
+	fmt.Fprintf(t.out, "\x1b[0m\x1b[%d;1H\x1b[?25h\r\n", rows+2)
+	err := t.out.Flush()
+	if t.restore != nil {
+		if rerr := t.restore(); rerr != nil {
+			return rerr
+		}
+	}
+	return err
+}
+
+// SetPalette sets the colours the pixels are drawn with, redrawing the
+// whole screen on the next frame
+func (t *Terminal) SetPalette(p palette.Palette) {
+	t.palette = p
+	t.drawn = false
+}
+
+// Rewinding is true while backspace is held
+func (t *Terminal) Rewinding() bool {
+	return t.rewind.down
+}
+
+// SetWaitingForKey shows in the status line when the ROM is blocked
+// waiting for a key
+func (t *Terminal) SetWaitingForKey(waiting bool) {
+	t.waitingForKey = waiting
+	t.updateStatus()
+}
+
+// SetFault shows in the status line the fault that stopped the ROM, nil
+// once it runs again
+func (t *Terminal) SetFault(fault error) {
+	t.fault = fault
+	t.updateStatus()
+}
+
+// updateStatus sets the status line text, drawn with the next frame
+func (t *Terminal) updateStatus() {
+	switch {
+	case t.fault != nil:
+		t.status = "stopped: " + t.fault.Error()
+	case t.waitingForKey:
+		t.status = "waiting for key"
+	default:
+		t.status = ""
+	}
+}
+
+// cellsSize returns the character cells the current frame covers
+func (t *Terminal) cellsSize() (int, int) {
+	cw, ch := t.cfg.Mode.cellSize()
+	return (t.width + cw - 1) / cw, (t.height + ch - 1) / ch
+}
+
+// Present draws a width x height framebuffer, only writing the cells that
+// differ from the previous frame
+func (t *Terminal) Present(buf []uint32, width, height int) {
+	if width != t.width || height != t.height || !t.drawn {
+		t.width, t.height = width, height
+		cols, rows := t.cellsSize()
+		t.cells = make([]cell, cols*rows)
+		t.drawn = false
+		t.out.WriteString("\x1b[0m\x1b[2J")
+		t.shownStatus = ""
+	}
+	cols, rows := t.cellsSize()
+	//the pen colours and cursor position are unknown at the start of a
+	//frame, -1 forces the first cell drawn to set them
+	fg, bg := int64(-1), int64(-1)
+	curX, curY := -1, -1
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			c := t.cell(buf, x, y)
+			i := y*cols + x
+			if t.drawn && t.cells[i] == c {
+				continue
+			}
+			t.cells[i] = c
+			if curX != x || curY != y {
+				fmt.Fprintf(t.out, "\x1b[%d;%dH", y+1, x+1)
+			}
+			if int64(c.fg) != fg {
+				fmt.Fprintf(t.out, "\x1b[38;2;%d;%d;%dm", c.fg>>16&0xFF, c.fg>>8&0xFF, c.fg&0xFF)
+				fg = int64(c.fg)
+			}
+			if int64(c.bg) != bg {
+				fmt.Fprintf(t.out, "\x1b[48;2;%d;%d;%dm", c.bg>>16&0xFF, c.bg>>8&0xFF, c.bg&0xFF)
+				bg = int64(c.bg)
+			}
+			t.out.WriteRune(c.char)
+			curX, curY = x+1, y
+		}
+	}
+	t.drawn = true
+	if t.status != t.shownStatus {
+		fmt.Fprintf(t.out, "\x1b[0m\x1b[%d;1H\x1b[2K%s", rows+1, t.status)
+		t.shownStatus = t.status
+	}
+	t.out.Flush()
+}
+
+// brailleDots are the braille pattern bits of the 2x4 pixels of a cell,
+// indexed by row then column
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// cell builds the character drawing the pixels of the cell at x, y
+func (t *Terminal) cell(buf []uint32, x, y int) cell {
+	pixel := func(px, py int) uint32 {
+		if px >= t.width || py >= t.height {
+			return 0
+		}
+		return buf[py*t.width+px] & 0x3
+	}
+	if t.cfg.Mode == HalfBlock {
+		return cell{'▀', t.palette[pixel(x, 2*y)], t.palette[pixel(x, 2*y+1)]}
+	}
+	//braille has a single foreground colour, the lit dot with the lowest
+	//plane bitmask picks it
+	char, lit := rune(0x2800), uint32(0)
+	for dy, row := range brailleDots {
+		for dx, dot := range row {
+			if p := pixel(2*x+dx, 4*y+dy); p != 0 {
+				char |= dot
+				if lit == 0 || p < lit {
+					lit = p
+				}
+			}
+		}
+	}
+	return cell{char, t.palette[lit], t.palette[0]}
+}
+
+// Poll forwards the keys pressed since the last call and releases the keys
+// whose hold ran out, as a machine keypad backend. It returns false when
+// escape or ctrl-c is pressed or stdin is closed
+func (t *Terminal) Poll(keys machine.Keys) bool {
+	now := t.now()
+	for {
+		select {
+		case data, ok := <-t.input:
+			if !ok {
+				return false
+			}
+			if !t.handleInput(data, now, keys) {
+				return false
+			}
+			continue
+		default:
+		}
+		break
+	}
+	if len(t.pending) > 0 && now.Sub(t.pendingSince) >= escapeTimeout {
+		//the rest never came, only a lone escape means anything
+		quit := string(t.pending) == "\x1b"
+		t.pending = nil
+		if quit {
+			return false
+		}
+	}
+	for k := range t.held {
+		if h := &t.held[k]; h.down && now.After(h.until) {
+			h.down = false
+			keys.KeyUp(uint8(k))
+		}
+	}
+	if t.rewind.down && now.After(t.rewind.until) {
+		t.rewind.down = false
+	}
+	return true
+}
+
+// handleInput presses the keys in data, returning false on a quit key
+func (t *Terminal) handleInput(data []byte, now time.Time, keys machine.Keys) bool {
+	seqs, rest := splitKeys(append(t.pending, data...))
+	if len(rest) > 0 && (len(t.pending) == 0 || len(seqs) > 0) {
+		t.pendingSince = now
+	}
+	t.pending = rest
+	for _, seq := range seqs {
+		switch seq {
+		case "\x1b", "\x03":
+			return false
+		case "\x7f", "\x08":
+			t.press(&t.rewind, now)
+			continue
+		}
+		for _, k := range t.keys[seq] {
+			if !t.held[k].down {
+				keys.KeyDown(k)
+			}
+			t.press(&t.held[k], now)
+		}
+	}
+	return true
+}
+
+// press holds h, for FirstHold on the first press and RepeatHold more for
+// every auto-repeat
+func (t *Terminal) press(h *hold, now time.Time) {
+	if !h.down {
+		h.down = true
+		h.until = now.Add(t.cfg.FirstHold)
+		return
+	}
+	if until := now.Add(t.cfg.RepeatHold); until.After(h.until) {
+		h.until = until
+	}
+}
@@ -0,0 +1,195 @@
+package term
+
+import (
+	"bytes"
+	"fmt"
+	"gochip8/internal/keymap"
+	"gochip8/internal/palette"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitKeys(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		seqs []string
+		rest string
+	}{
+		{"characters", "a1 ", []string{"a", "1", " "}, ""},
+		{"arrows", "\x1b[A\x1bOB", []string{"\x1b[A", "\x1bOB"}, ""},
+		{"csi with parameters", "\x1b[1;5Cx", []string{"\x1b[1;5C", "x"}, ""},
+		{"utf-8", "é€", []string{"é", "€"}, ""},
+		{"escape then a key", "\x1bq", []string{"\x1b", "q"}, ""},
+		{"control bytes", "\x03\x7f", []string{"\x03", "\x7f"}, ""},
+		{"trailing escape", "a\x1b", []string{"a"}, "\x1b"},
+		{"trailing csi", "a\x1b[", []string{"a"}, "\x1b["},
+		{"csi cut in its parameters", "\x1b[1;5", nil, "\x1b[1;5"},
+		{"trailing ss3", "\x1bO", nil, "\x1bO"},
+		{"cut utf-8", "a\xc3", []string{"a"}, "\xc3"},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			seqs, rest := splitKeys([]byte(tc.data))
+			if !reflect.DeepEqual(seqs, tc.seqs) || string(rest) != tc.rest {
+				t.Errorf("splitKeys(%q) = %q, %q, want %q, %q", tc.data, seqs, rest, tc.seqs, tc.rest)
+			}
+		})
+	}
+}
+
+// keyLog records the keypad transitions as "+K" and "-K"
+type keyLog []string
+
+func (l *keyLog) KeyDown(key uint8) { *l = append(*l, fmt.Sprintf("+%X", key)) }
+func (l *keyLog) KeyUp(key uint8)   { *l = append(*l, fmt.Sprintf("-%X", key)) }
+
+// newTerminal returns a terminal writing to out whose input is fed by
+// sending on its input channel and whose clock is *now
+func newTerminal(t *testing.T, out io.Writer, cfg Config, now *time.Time) *Terminal {
+	t.Helper()
+	in, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	term := New(in, out, cfg)
+	term.now = func() time.Time { return *now }
+	km, err := keymap.Builtin("qwerty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	km[5] = append(km[5], "Up")
+	if err := term.SetKeymap(km); err != nil {
+		t.Fatal(err)
+	}
+	return term
+}
+
+func TestPollEscapeSequences(t *testing.T) {
+	now := time.Unix(0, 0)
+	term := newTerminal(t, io.Discard, Config{}, &now)
+	var keys keyLog
+	poll := func(after time.Duration, data ...string) bool {
+		t.Helper()
+		now = now.Add(after)
+		for _, d := range data {
+			term.input <- []byte(d)
+		}
+		return term.Poll(&keys)
+	}
+
+	if !poll(0, "\x1b", "[A") {
+		t.Fatal("an arrow split across reads quit")
+	}
+	if !poll(10*time.Millisecond, "\x1b[") || !poll(10*time.Millisecond, "A") {
+		t.Fatal("an arrow split across polls quit")
+	}
+	if !poll(time.Second, "\x1b[") || !poll(time.Second) {
+		t.Fatal("an unfinished escape sequence quit")
+	}
+	if !poll(0, "w") {
+		t.Fatal("a key after a dropped escape sequence quit")
+	}
+	if want := (keyLog{"+5", "-5", "+5"}); !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+
+	if !poll(0, "\x1b") {
+		t.Fatal("escape quit before the rest of a sequence could arrive")
+	}
+	if poll(escapeTimeout) {
+		t.Error("a lone escape didn't quit")
+	}
+}
+
+func TestPollHoldsKeys(t *testing.T) {
+	now := time.Unix(0, 0)
+	term := newTerminal(t, io.Discard, Config{FirstHold: 500 * time.Millisecond, RepeatHold: 100 * time.Millisecond}, &now)
+	var keys keyLog
+	term.input <- []byte("q")
+	term.Poll(&keys)
+	now = now.Add(450 * time.Millisecond)
+	term.input <- []byte("q")
+	term.Poll(&keys)
+	now = now.Add(100 * time.Millisecond)
+	term.Poll(&keys)
+	if want := (keyLog{"+4"}); !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v while repeating, want %v", keys, want)
+	}
+	now = now.Add(100 * time.Millisecond)
+	term.Poll(&keys)
+	if want := (keyLog{"+4", "-4"}); !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v once repeats stopped, want %v", keys, want)
+	}
+
+	for _, quit := range []string{"\x03", "\x1bq"} {
+		term.input <- []byte(quit)
+		if term.Poll(&keys) {
+			t.Errorf("%q didn't quit", quit)
+		}
+	}
+}
+
+// fg and bg return the escape sequences setting the pen colours
+func fg(c uint32) string {
+	return fmt.Sprintf("\x1b[38;2;%d;%d;%dm", c>>16&0xFF, c>>8&0xFF, c&0xFF)
+}
+
+func bg(c uint32) string {
+	return fmt.Sprintf("\x1b[48;2;%d;%d;%dm", c>>16&0xFF, c>>8&0xFF, c&0xFF)
+}
+
+func TestPresentDiffs(t *testing.T) {
+	now := time.Unix(0, 0)
+	out := &bytes.Buffer{}
+	term := newTerminal(t, out, Config{Mode: HalfBlock}, &now)
+	p := palette.Default()
+	buf := make([]uint32, 4*2)
+
+	out.Reset()
+	term.Present(buf, 4, 2)
+	if want := "\x1b[0m\x1b[2J\x1b[1;1H" + fg(p[0]) + bg(p[0]) + "▀▀▀▀"; out.String() != want {
+		t.Errorf("first frame wrote %q, want %q", out, want)
+	}
+
+	out.Reset()
+	term.Present(buf, 4, 2)
+	if out.Len() != 0 {
+		t.Errorf("an unchanged frame wrote %q", out)
+	}
+
+	out.Reset()
+	buf[1*4+2] = 1
+	buf[0*4+3] = 2
+	term.Present(buf, 4, 2)
+	if want := "\x1b[1;3H" + fg(p[0]) + bg(p[1]) + "▀" + fg(p[2]) + bg(p[0]) + "▀"; out.String() != want {
+		t.Errorf("changing two cells wrote %q, want %q", out, want)
+	}
+
+	out.Reset()
+	term.Present(make([]uint32, 2*2), 2, 2)
+	if want := "\x1b[0m\x1b[2J\x1b[1;1H" + fg(p[0]) + bg(p[0]) + "▀▀"; out.String() != want {
+		t.Errorf("resizing wrote %q, want a full redraw %q", out, want)
+	}
+}
+
+func TestPresentBraille(t *testing.T) {
+	now := time.Unix(0, 0)
+	out := &bytes.Buffer{}
+	term := newTerminal(t, out, Config{Mode: Braille}, &now)
+	p := palette.Default()
+	buf := make([]uint32, 4*4)
+	buf[0*4+0] = 2
+	buf[2*4+1] = 1
+	buf[3*4+3] = 3
+
+	out.Reset()
+	term.Present(buf, 4, 4)
+	//the first plane is the lowest lit bitmask in the first cell
+	want := "\x1b[0m\x1b[2J\x1b[1;1H" + fg(p[1]) + bg(p[0]) + string(rune(0x2800|0x01|0x20)) +
+		fg(p[3]) + string(rune(0x2800|0x80))
+	if out.String() != want {
+		t.Errorf("Present wrote %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,52 @@
+package ui
+
+import (
+	"encoding/binary"
+	"gochip8/internal/audio"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// maxQueuedFrames bounds the audio queued ahead of playback, frames that
+// would exceed it are dropped so the sound never lags behind the picture
+const maxQueuedFrames = 4
+
+// SDLAudio is an audio.AudioSink playing through the default SDL audio device
+type SDLAudio struct {
+	device sdl.AudioDeviceID
+	buf    []byte
+}
+
+// OpenAudio opens the default audio device for the window's buzzer
+func (ui *UI) OpenAudio() (*SDLAudio, error) {
+	spec := &sdl.AudioSpec{
+		Freq:     audio.SampleRate,
+		Format:   sdl.AUDIO_S16LSB,
+		Channels: 1,
+		Samples:  1024,
+	}
+	device, err := sdl.OpenAudioDevice("", false, spec, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	sdl.PauseAudioDevice(device, false)
+	return &SDLAudio{device: device}, nil
+}
+
+// Write queues samples for playback
+func (a *SDLAudio) Write(samples []int16) error {
+	if sdl.GetQueuedAudioSize(a.device) > maxQueuedFrames*audio.SamplesPerFrame*2 {
+		return nil
+	}
+	a.buf = a.buf[:0]
+	for _, s := range samples {
+		a.buf = binary.LittleEndian.AppendUint16(a.buf, uint16(s))
+	}
+	return sdl.QueueAudio(a.device, a.buf)
+}
+
+// Close closes the audio device
+func (a *SDLAudio) Close() error {
+	sdl.CloseAudioDevice(a.device)
+	return nil
+}
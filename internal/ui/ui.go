@@ -1,6 +1,10 @@
 package ui
 
 import (
+	"fmt"
+	"gochip8/internal/keymap"
+	"gochip8/internal/machine"
+	"gochip8/internal/palette"
 	"image/color"
 	"log"
 	"time"
@@ -8,11 +12,52 @@ import (
 	"github.com/veandco/go-sdl2/sdl"
 )
 
+// Keypad receives the hex keypad presses, implemented by *chip8.Chip8
+type Keypad = machine.Keys
+
+// stateSlotKeys binds F1-F10 to save state slots 1-10
+var stateSlotKeys = map[sdl.Keycode]int{
+	sdl.K_F1:  1,
+	sdl.K_F2:  2,
+	sdl.K_F3:  3,
+	sdl.K_F4:  4,
+	sdl.K_F5:  5,
+	sdl.K_F6:  6,
+	sdl.K_F7:  7,
+	sdl.K_F8:  8,
+	sdl.K_F9:  9,
+	sdl.K_F10: 10,
+}
+
+// StateSlotHandler is called when a save state slot key is pressed,
+// load is true when shift was held
+type StateSlotHandler func(slot int, load bool)
+
+// screenshotKey saves a screenshot through the screenshot handler and
+// captureKey starts or stops a recording through the capture handler
+const (
+	screenshotKey = sdl.K_F12
+	captureKey    = sdl.K_F11
+)
+
 type UI struct {
 	window              *sdl.Window
 	renderer            *sdl.Renderer
 	surface             *sdl.Surface
 	lastUpdateCycleTime []int64
+	onStateSlot         StateSlotHandler
+	onScreenshot        func()
+	onCapture           func()
+	// colors maps the plane bitmask of a pixel to its colour
+	colors        color.Palette
+	rewinding     bool
+	waitingForKey bool
+	fault         error
+	sigStep       chan bool
+	// keypadKeys maps each physical key to the hex keys bound to it and
+	// held counts the physical keys holding each hex key down
+	keypadKeys map[sdl.Keycode][]uint8
+	held       [16]int
 }
 
 func (ui *UI) Clear() {
@@ -28,6 +73,11 @@ func (ui *UI) GetRenderer() *sdl.Renderer {
 	return ui.renderer
 }
 
+// Rewinding reports whether the rewind key (backspace) is held
+func (ui *UI) Rewinding() bool {
+	return ui.rewinding
+}
+
 func (ui *UI) GetLastUpdateCycleTime() []int64 {
 	return ui.lastUpdateCycleTime
 }
@@ -46,39 +96,133 @@ func Init() (*UI, error) {
 	if err != nil {
 		return nil, err
 	}
-	surface, err := sdl.CreateRGBSurface(0, 64, 32, 32, 0x000000FF, 0x0000FF00, 0x00FF0000, 0xFF000000)
+	surface, err := createSurface(64, 32)
+	if err != nil {
+		return nil, err
+	}
+	ui := &UI{
+		window:              window,
+		renderer:            renderer,
+		surface:             surface,
+		lastUpdateCycleTime: []int64{},
+	}
+	km, err := keymap.Builtin(keymap.DefaultLayout)
 	if err != nil {
 		return nil, err
 	}
-	return &UI{window, renderer, surface, []int64{}}, nil
+	if err := ui.SetKeymap(km); err != nil {
+		return nil, err
+	}
+	ui.SetPalette(palette.Default())
+	return ui, nil
 }
 
-func (ui *UI) makeColor(incomingColor uint32) color.Color {
-	r := incomingColor >> 24 & 0xFF
-	g := incomingColor >> 16 & 0xFF
-	b := incomingColor >> 8 & 0xFF
-	a := incomingColor & 0xFF
-	return color.NRGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: uint8(a)}
+// SetKeymap binds the physical keys named in km to the hex keypad
+func (ui *UI) SetKeymap(km keymap.Keymap) error {
+	keys := map[sdl.Keycode][]uint8{}
+	for k, names := range km {
+		for _, name := range names {
+			code := sdl.GetKeyFromName(name)
+			if code == sdl.K_UNKNOWN {
+				return fmt.Errorf("unknown key %q bound to %X", name, k)
+			}
+			keys[code] = append(keys[code], uint8(k))
+		}
+	}
+	ui.keypadKeys = keys
+	ui.held = [16]int{}
+	return nil
 }
 
-func (ui *UI) putPixel(x, y int, color uint32) {
+// SetWaitingForKey shows in the window title when the ROM is blocked
+// waiting for a key
+func (ui *UI) SetWaitingForKey(waiting bool) {
+	if waiting == ui.waitingForKey {
+		return
+	}
+	ui.waitingForKey = waiting
+	ui.updateTitle()
+}
+
+// SetFault shows in the window title the fault that stopped the ROM, nil
+// once it runs again
+func (ui *UI) SetFault(fault error) {
+	if fault == ui.fault {
+		return
+	}
+	ui.fault = fault
+	ui.updateTitle()
+}
+
+// updateTitle shows the fault or key wait, if any, in the window title
+func (ui *UI) updateTitle() {
+	switch {
+	case ui.fault != nil:
+		ui.window.SetTitle("Chip8 - stopped: " + ui.fault.Error())
+	case ui.waitingForKey:
+		ui.window.SetTitle("Chip8 - waiting for key")
+	default:
+		ui.window.SetTitle("Chip8")
+	}
+}
+
+// SetStateSlotHandler registers the handler for the save state keys,
+// F1-F10 save to a slot and shift+F1-F10 load from it
+func (ui *UI) SetStateSlotHandler(handler StateSlotHandler) {
+	ui.onStateSlot = handler
+}
+
+// SetScreenshotHandler registers the handler for the screenshot key, F12
+func (ui *UI) SetScreenshotHandler(handler func()) {
+	ui.onScreenshot = handler
+}
+
+// SetCaptureHandler registers the handler for the recording key, F11
+func (ui *UI) SetCaptureHandler(handler func()) {
+	ui.onCapture = handler
+}
+
+// SetPalette sets the colours the pixels are drawn with
+func (ui *UI) SetPalette(p palette.Palette) {
+	ui.colors = p.Colors()
+}
+
+// createSurface creates the surface the framebuffer is drawn into before
+// being scaled up to the window
+func createSurface(width, height int) (*sdl.Surface, error) {
+	return sdl.CreateRGBSurface(0, int32(width), int32(height), 32, 0x000000FF, 0x0000FF00, 0x00FF0000, 0xFF000000)
+}
+
+func (ui *UI) putPixel(x, y int, color color.Color) {
 	ui.surface.Lock()
-	ui.surface.Set(x, y, ui.makeColor(color))
+	ui.surface.Set(x, y, color)
 	ui.surface.Unlock()
 }
 
-func (ui *UI) Update(buf [2048]uint32) {
+// Present draws a width x height framebuffer through the palette,
+// scaled to fill the window
+func (ui *UI) Present(buf []uint32, width, height int) {
 	t1 := time.Now().UnixMilli()
-	for i := 0; i < 2048; i++ {
-		x := i % 64
-		y := i / 64
-		ui.putPixel(x, y, buf[i])
+	if int(ui.surface.W) != width || int(ui.surface.H) != height {
+		surface, err := createSurface(width, height)
+		if err != nil {
+			log.Println("Error resizing surface: ", err)
+			return
+		}
+		ui.surface.Free()
+		ui.surface = surface
+	}
+	for i := 0; i < width*height; i++ {
+		x := i % width
+		y := i / width
+		ui.putPixel(x, y, ui.colors[buf[i]&0x3])
 	}
 	tex, err := ui.renderer.CreateTextureFromSurface(ui.surface)
 	if err != nil {
 		log.Println("Error creating texture from surface: ", err)
 		return
 	}
+	defer tex.Destroy()
 	ui.renderer.Clear()
 	ui.renderer.Copy(tex, nil, nil)
 	ui.renderer.Present()
@@ -86,89 +230,70 @@ func (ui *UI) Update(buf [2048]uint32) {
 	ui.lastUpdateCycleTime = append(ui.lastUpdateCycleTime, t2-t1)
 }
 
-func (ui *UI) ProcessInput(keys *[16]byte, sigStep chan bool) bool {
+// SetStepSignal sets the channel the single step key (space) signals on
+// when input is polled through Poll
+func (ui *UI) SetStepSignal(sigStep chan bool) {
+	ui.sigStep = sigStep
+}
+
+// Poll processes the pending input as a machine keypad backend
+func (ui *UI) Poll(keys machine.Keys) bool {
+	return ui.ProcessInput(keys, ui.sigStep)
+}
+
+// ProcessInput drains the SDL event queue, forwarding the hex keypad keys
+// to keypad and handling the emulator hotkeys. It returns false when the
+// window is closed or escape is pressed
+func (ui *UI) ProcessInput(keypad Keypad, sigStep chan bool) bool {
 	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
 		switch event := event.(type) {
 		case *sdl.QuitEvent:
 			return false
 		case *sdl.KeyboardEvent:
-			typ := event.Type
-			switch typ {
+			key := event.Keysym.Sym
+			if event.Repeat != 0 {
+				continue
+			}
+			switch event.Type {
 			case sdl.KEYDOWN:
-				key := event.Keysym.Sym
+				if slot, ok := stateSlotKeys[key]; ok && ui.onStateSlot != nil {
+					ui.onStateSlot(slot, event.Keysym.Mod&uint16(sdl.KMOD_SHIFT) != 0)
+					continue
+				}
+				if key == screenshotKey && ui.onScreenshot != nil {
+					ui.onScreenshot()
+					continue
+				}
+				if key == captureKey && ui.onCapture != nil {
+					ui.onCapture()
+					continue
+				}
 				switch key {
 				case sdl.K_ESCAPE:
 					return false
 				case sdl.K_SPACE:
-					sigStep <- true
-				case sdl.K_x:
-					keys[0] = 1
-				case sdl.K_1:
-					keys[1] = 1
-				case sdl.K_2:
-					keys[2] = 1
-				case sdl.K_3:
-					keys[3] = 1
-				case sdl.K_q:
-					keys[4] = 1
-				case sdl.K_w:
-					keys[5] = 1
-				case sdl.K_e:
-					keys[6] = 1
-				case sdl.K_a:
-					keys[7] = 1
-				case sdl.K_s:
-					keys[8] = 1
-				case sdl.K_d:
-					keys[9] = 1
-				case sdl.K_z:
-					keys[0xA] = 1
-				case sdl.K_c:
-					keys[0xB] = 1
-				case sdl.K_4:
-					keys[0xC] = 1
-				case sdl.K_r:
-					keys[0xD] = 1
-				case sdl.K_f:
-					keys[0xE] = 1
-				case sdl.K_v:
-					keys[0xF] = 1
+					select {
+					case sigStep <- true:
+					default:
+					}
+				case sdl.K_BACKSPACE:
+					ui.rewinding = true
+				}
+				for _, k := range ui.keypadKeys[key] {
+					if ui.held[k]++; ui.held[k] == 1 {
+						keypad.KeyDown(k)
+					}
 				}
 			case sdl.KEYUP:
-				key := event.Keysym.Sym
-				switch key {
-				case sdl.K_x:
-					keys[0] = 0
-				case sdl.K_1:
-					keys[1] = 0
-				case sdl.K_2:
-					keys[2] = 0
-				case sdl.K_3:
-					keys[3] = 0
-				case sdl.K_q:
-					keys[4] = 0
-				case sdl.K_w:
-					keys[5] = 0
-				case sdl.K_e:
-					keys[6] = 0
-				case sdl.K_a:
-					keys[7] = 0
-				case sdl.K_s:
-					keys[8] = 0
-				case sdl.K_d:
-					keys[9] = 0
-				case sdl.K_z:
-					keys[0xA] = 0
-				case sdl.K_c:
-					keys[0xB] = 0
-				case sdl.K_4:
-					keys[0xC] = 0
-				case sdl.K_r:
-					keys[0xD] = 0
-				case sdl.K_f:
-					keys[0xE] = 0
-				case sdl.K_v:
-					keys[0xF] = 0
+				if key == sdl.K_BACKSPACE {
+					ui.rewinding = false
+				}
+				for _, k := range ui.keypadKeys[key] {
+					if ui.held[k] > 0 {
+						if ui.held[k]--; ui.held[k] == 0 {
+							keypad.KeyUp(k)
+						}
+					}
 				}
 			}
 		}
@@ -0,0 +1,115 @@
+package roms_test
+
+import (
+	"fmt"
+	"gochip8/internal/chip8"
+	"gochip8/internal/clog"
+	"gochip8/internal/headless"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// conformanceROM is a test ROM that is run headlessly under every quirks
+// profile, the screen it ends on is compared with a golden image
+type conformanceROM struct {
+	// file is the ROM in this directory
+	file   string
+	frames int
+	ipf    int
+}
+
+// conformanceROMs lists the test ROMs. Their golden images are the screens
+// the ROMs' authors document for a passing interpreter: every test_opcode
+// result reads OK and the IBM logo is drawn whole. They are checked by eye
+// against those screens and never generated by this emulator, which would
+// only test it against itself. A ROM is only added here together with its
+// checked golden images
+var conformanceROMs = []conformanceROM{
+	{file: "test_opcode.ch8", frames: 30, ipf: 100},
+	{file: "ibm.ch8", frames: 30, ipf: 100},
+}
+
+func TestConformance(t *testing.T) {
+	for _, rom := range conformanceROMs {
+		for _, profile := range chip8.QuirksProfileNames() {
+			rom, profile := rom, profile
+			t.Run(rom.file+"/"+profile, func(t *testing.T) {
+				rom.check(t, profile)
+			})
+		}
+	}
+}
+
+// check runs the ROM under profile and compares its screen with the
+// golden image
+func (rom conformanceROM) check(t *testing.T, profile string) {
+	data, err := os.ReadFile(rom.file)
+	if err != nil {
+		t.Fatalf("%s must be in the roms directory: %v", rom.file, err)
+	}
+	quirks, err := chip8.QuirksProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := chip8.Init(quirks)
+	c.SetLogger(clog.NewLogWithWriters(int(clog.LogLevelInfo), "Chip8", nil))
+	c.SetErrorPolicy(chip8.Strict)
+	c.Load(data)
+	c.SetSeed(0)
+	if err := headless.Continue(c, headless.Config{IPF: rom.ipf, Frames: rom.frames}); err != nil {
+		t.Fatalf("%v\n%s", err, headless.ASCII(c))
+	}
+
+	golden := filepath.Join("testdata", strings.TrimSuffix(rom.file, ".ch8")+"."+profile+".png")
+	want, err := readGolden(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := compareScreen(c, want); diff != "" {
+		t.Errorf("screen differs from %s: %s\n%s", golden, diff, headless.ASCII(c))
+	}
+}
+
+// readGolden decodes a golden image written by headless.WritePNG
+func readGolden(path string) (*image.Paletted, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	paletted, ok := img.(*image.Paletted)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a paletted image", path)
+	}
+	return paletted, nil
+}
+
+// compareScreen describes how the chip8 display differs from want, or
+// returns "" when they match
+func compareScreen(c *chip8.Chip8, want *image.Paletted) string {
+	width, height := c.GetDisplaySize()
+	if size := want.Bounds().Size(); size.X != width || size.Y != height {
+		return fmt.Sprintf("resolution is %dx%d, want %dx%d", width, height, size.X, size.Y)
+	}
+	buf := c.GetDisplayBuffer()
+	diff := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if uint8(buf[y*width+x]&chip8.PlaneMask) != want.ColorIndexAt(x, y) {
+				diff++
+			}
+		}
+	}
+	if diff == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d pixels differ", diff)
+}
@@ -41,6 +41,11 @@ var TestRomRaw = []byte{
 func DumpRomInfo(buf []byte) {
 	fmt.Println("Dumping ROM info...", len(buf), "bytes")
 	for i := 0; i < len(buf); i += 2 {
+		if i+1 == len(buf) {
+			fmt.Printf("0x%X, trailing byte", buf[i])
+			fmt.Println()
+			break
+		}
 		sl := buf[i : i+2]
 		fmt.Printf("0x%X, shift:  %x", sl, binary.BigEndian.Uint16(sl)>>12)
 		fmt.Println()